@@ -1,6 +1,7 @@
 package common
 
 import (
+  "big";
   "fmt";
 )
 
@@ -21,27 +22,106 @@ const (
   TYPE_INT;
   TYPE_CHAR;
   TYPE_STRING;
+  TYPE_INT1;
+  TYPE_INT2;
+  TYPE_INT3;
+  TYPE_INT4;
+  TYPE_INT6;
+  TYPE_INT8;
+  TYPE_FLOAT;
+
+  // typed strings (see strtypes.go):
+  TYPE_DATE;
+  TYPE_FILENAME;
+  TYPE_REGEXP;
+  TYPE_TIMESTAMP;
+  TYPE_TIME;
+  TYPE_URL;
+
+  // New data types have to be added above, registered string types
+  // (see RegisterStringType) get the data types from here on:
+  TYPE_FIRST_REGISTERED = 1000;
 )
+func (dt DataTypeEnum) String() string {
+  ret := "";
+  switch dt {
+  case TYPE_UNKNOWN: ret = "<unknown type>";
+  case TYPE_BOOL:    ret = "Bool";
+  case TYPE_INT:     ret = "Int";
+  case TYPE_CHAR:    ret = "Char";
+  case TYPE_STRING:  ret = "String";
+  case TYPE_FLOAT:   ret = "Float";
+  default:
+    if size := dt.IntSize(); size > 0 {
+      ret = fmt.Sprintf("Int%d", size);
+    } else if st := dt.StringType(); st != nil {
+      ret = st.Name;
+    } else {
+      ret = fmt.Sprintf("<TYPE %d>", dt);
+    }
+  }
+  return ret;
+}
+
+// The sizes of the integer types in bytes.
+var intSizes = map[DataTypeEnum]int {
+  TYPE_INT: 8,
+  TYPE_INT1: 1, TYPE_INT2: 2, TYPE_INT3: 3, TYPE_INT4: 4, TYPE_INT6: 6,
+  TYPE_INT8: 8,
+}
+
+// IntSize - Return the size of an integer type in bytes or 0 for all other
+// data types.
+func (dt DataTypeEnum) IntSize() int {
+  return intSizes[dt];
+}
+
+// FitsInt64 - Can the integer of any size be stored in 64 bits?
+func FitsInt64(bi *big.Int) bool {
+  return bi.Cmp(big.NewInt(-1 << 63)) >= 0 &&
+         bi.Cmp(big.NewInt(1<<63 - 1)) <= 0;
+}
+
+// IntTypeNamed - Return the integer type with the given name (e.g. Int4)
+// or TYPE_UNKNOWN if there is none.
+func IntTypeNamed(name string) DataTypeEnum {
+  for dt, _ := range intSizes {
+    if dt.String() == name { return dt; }
+  }
+  return TYPE_UNKNOWN;
+}
 
 
 func Any2bool(val interface{}) bool {
   pb, ok := val.(*bool);
-  if !ok { HandleFatal(fmt.Sprint("Unable to convert to boolean:", val)); }
+  if !ok { panic(fmt.Sprint("Unable to convert to boolean:", val)); }
   return *pb;
 }
+// Any2int - Integers of any size have to fit into 64 bits.
 func Any2int(val interface{}) int64 {
+  if bi, ok := val.(*big.Int); ok {
+    if !FitsInt64(bi) {
+      panic(fmt.Sprint("Integer too big for 64 bits:", bi));
+    }
+    return bi.Int64();
+  }
   pi, ok := val.(*int64);
-  if !ok { HandleFatal(fmt.Sprint("Unable to convert to integer:", val)); }
+  if !ok { panic(fmt.Sprint("Unable to convert to integer:", val)); }
   return *pi;
 }
-func Any2char(val interface{}) byte {
-  pc, ok := val.(*byte);
-  if !ok { HandleFatal(fmt.Sprint("Unable to convert to character:", val)); }
+func Any2float(val interface{}) float64 {
+  pf, ok := val.(*float64);
+  if !ok { panic(fmt.Sprint("Unable to convert to float:", val)); }
+  return *pf;
+}
+func Any2char(val interface{}) int {
+  pc, ok := val.(*int);
+  if !ok { panic(fmt.Sprint("Unable to convert to character:", val)); }
   return *pc;
 }
 func Any2string(val interface{}) string {
   ps, ok := val.(*string);
-  if !ok { HandleFatal(fmt.Sprint("Unable to convert to string:", val)); }
+  if !ok { panic(fmt.Sprint("Unable to convert to string:", val)); }
   return *ps;
 }
 
@@ -55,6 +135,7 @@ type AstNode interface {
 type ExprAst interface {
   AstNode;
   DataType() DataTypeEnum;
+  SetDataType(dataType DataTypeEnum);
 }
 
 /// LiteralExprAst - Interface of expressions for literals like 123, 'c' or "abc".
@@ -81,6 +162,8 @@ type ConstantExprAst interface {
   Module()       string;
   ConstantName() string;
   SubIds()       []SubId;
+  ConstDef()     ConstDefAst;  // set by the checker for local constants
+  SetConstDef(def ConstDefAst);
 }
 
 /// CallExprAst - Interface of expressions for function calls.
@@ -91,6 +174,31 @@ type CallExprAst interface {
   CallType()     CallTypeEnum;
   HalfApplied()  bool;
   Args()         []ExprAst;
+  Prototype()    PrototypeAst; // set by the checker for local functions
+  SetPrototype(proto PrototypeAst);
+}
+
+// IsOperator - Is the called function an operator?
+// Function names start with an upper case letter (after the '_' of
+// protected functions) while operators consist of operator characters.
+func IsOperator(name string) bool {
+  if len(name) > 1 && name[0] == '_' { name = name[1:len(name)]; }
+  return name[0] < 'A' || name[0] > 'Z';
+}
+
+// IfContinuation - Return the argument of an If as Elif with a condition
+// and a result or as Else with a result (only as last argument).
+// Anything else stops the work (see Abort), so the code generators can
+// trust the continuations of an If even if the checker rejected them.
+func IfContinuation(arg ExprAst, last bool) CallExprAst {
+  cont, ok := arg.(CallExprAst);
+  if !ok || cont.Module() != "" ||
+     !(cont.FuncName() == "Elif" && len(cont.Args()) == 2 ||
+       cont.FuncName() == "Else" && len(cont.Args()) == 1 && last) {
+    Abort(arg.SourcePiece(), "Expected Elif with a condition and a " +
+          "result or Else with a result");
+  }
+  return cont;
 }
 
 /// AssignmentAst - Interface of assignment statements line: value = expr
@@ -125,3 +233,46 @@ type FunctionAst interface {
   Body() ExprAst;
 }
 
+// ConstDefAst - Interface of the definition of a constant like: PI = 314
+type ConstDefAst interface {
+  AstNode;
+  ConstantName() string;
+  Expr() ExprAst;
+}
+
+// ImportAst - Interface of an import of another module like:
+//             import "diamond/io"
+type ImportAst interface {
+  AstNode;
+  Path() string;
+  ModuleName() string;
+}
+
+// BindAst - Interface of binding functions of another module like:
+//           bind io Print Read
+type BindAst interface {
+  AstNode;
+  Module()    string;
+  FuncNames() []string;
+  Shadowed()  bool;
+}
+
+// ShelfAst - Interface of a shelf that groups definitions of a module.
+type ShelfAst interface {
+  AstNode;
+  ShelfName() string;
+  Members()   []AstNode;
+}
+
+// ModuleAst - Interface of a whole module (the content of a source file).
+// The definitions inside of shelves are included in the lists, too.
+type ModuleAst interface {
+  AstNode;
+  Imports()    []ImportAst;
+  Binds()      []BindAst;
+  Shelves()    []ShelfAst;
+  Constants()  []ConstDefAst;
+  Prototypes() []PrototypeAst;
+  Functions()  []FunctionAst;
+}
+
@@ -1,14 +1,17 @@
 package common
 
 import (
-  "strings";
   "fmt";
   "os";
+  "io";
   "container/list";
 )
 
-var TABSIZE = 4;  // 'almost constant' should be set only by main!
-const EOF = 255;  // used between SrcBuffer and Lexer
+// 'almost constants' that should be set only by main!
+// A source can change them for itself with a pragma (see lexer).
+var TABSIZE = 4;
+var STRICT_INDENT = false;  // reject indentation with tabs and spaces mixed
+const EOF = -1;  // used between SrcBuffer and Lexer (never a valid rune)
 
 // --------------------------------------------------------------------------
 // Constants for token types:
@@ -48,7 +51,12 @@ const (
 
   // constant values:
   TOK_INT;
+  TOK_FLOAT;
   TOK_STR;
+  TOK_TYPED_STR;
+  TOK_STR_START;   // parts of a string with embedded expressions
+  TOK_STR_MIDDLE;
+  TOK_STR_END;
   TOK_CHAR;
 
   // keywords:
@@ -58,6 +66,9 @@ const (
   TOK_SHELF;
   TOK_BIND;
   TOK_SHADOWED;
+
+  // lexical error (already reported by the lexer):
+  TOK_ERROR;
 )
 func (te TokEnum) String() string {
   ret := "";
@@ -80,7 +91,12 @@ func (te TokEnum) String() string {
   case TOK_FUNC_ID:      ret = "<TOK FUNC ID>";
   case TOK_OP_ID:        ret = "<TOK OP ID>";
   case TOK_INT:          ret = "<TOK INT>";
+  case TOK_FLOAT:        ret = "<TOK FLOAT>";
   case TOK_STR:          ret = "<TOK STR>";
+  case TOK_TYPED_STR:    ret = "<TOK TYPED STR>";
+  case TOK_STR_START:    ret = "<TOK STR START>";
+  case TOK_STR_MIDDLE:   ret = "<TOK STR MIDDLE>";
+  case TOK_STR_END:      ret = "<TOK STR END>";
   case TOK_CHAR:         ret = "<TOK CHAR>";
   case TOK_DEF:          ret = "<TOK DEF>";
   case TOK_EXTERN:       ret = "<TOK EXTERN>";
@@ -88,6 +104,7 @@ func (te TokEnum) String() string {
   case TOK_SHELF:        ret = "<TOK SHELF>";
   case TOK_BIND:         ret = "<TOK BIND>";
   case TOK_SHADOWED:     ret = "<TOK SHADOWED>";
+  case TOK_ERROR:        ret = "<TOK ERROR>";
   default:               ret = fmt.Sprintf("<TOK %d>", te);
   }
   return ret;
@@ -98,27 +115,16 @@ func (te TokEnum) String() string {
 // Free functions:
 // --------------------------------------------------------------------------
 
-func IsSpace(ch byte) bool {
+func IsSpace(ch int) bool {
   return ch == ' ' || ch == '\t';
 }
-func SpaceAmount(ch byte) int {
+func SpaceAmount(ch int) int {
   ret := 0;
   if ch == ' '       { ret = 1; }
   else if ch == '\t' { ret = TABSIZE; }
   return ret;
 }
 
-func MakeErrString(msg string, lineNum int, lineStr string, markStart int, markLen int) string {
-  return fmt.Sprintf("%s at line %d near:\n", msg, lineNum+1) +
-         lineStr + "\n" +
-         strings.Repeat(" ", markStart) + strings.Repeat("^", markLen) + "\n";
-}
-
-func HandleFatal(msg string) {
-  fmt.Fprint(os.Stderr, "FATAL ERROR: " + msg);
-  os.Exit(1);
-}
-
 
 // --------------------------------------------------------------------------
 // Interfaces:
@@ -136,10 +142,16 @@ type SrcPiece interface {
   End() SrcMark;
   StartLine() int;
   StartColumn() int;
+  EndLine() int;
+  EndColumn() int;
+  FileName() string;
+  FileID() int;
   Content() string;
   WholeLine() string;
   String() string;
   Error(msg string);
+  Report(diag *Diagnostic);
+  Until(end SrcPiece) SrcPiece;
 }
 
 // the interface the Lexer needs as a source
@@ -148,7 +160,7 @@ type SrcBuffer interface {
   AtStartOfLine() bool;
   NotAtStartOfLine();
   Ungetch();
-  Getch() byte;
+  Getch() int;
   NewMark() SrcMark;
   NewPiece(start SrcMark) SrcPiece;
   NewAnyPiece(start SrcMark, end SrcMark) SrcPiece;
@@ -184,4 +196,19 @@ type TokenBuffer interface {
 }
 
 type Parser interface {
+  ParseModule() ModuleAst;
+  Error(msg string);
+}
+
+type Checker interface {
+  CheckModule(mod ModuleAst);
+}
+
+// Functions declared with 'extern' are implemented in Go for the interpreter
+type ExternFunc func(args []interface{}) interface{}
+
+type Interpreter interface {
+  Call(funcName string, args []interface{}) (interface{}, os.Error);
+  SetExtern(funcName string, fn ExternFunc);
+  SetOutput(out io.Writer);
 }
@@ -23,3 +23,210 @@ func TestSpaceAmount(t *testing.T) {
   if (SpaceAmount(0) != 0)          { t.Error("<NUL> recognized as space."); }
   if (SpaceAmount(12) != 0)         { t.Error("<^L> recognized as space."); }
 }
+
+func TestIsOperator(t *testing.T) {
+  for _, name := range []string{"+", "==", "<="} {
+    if !IsOperator(name) { t.Errorf("%s not recognized as operator.", name); }
+  }
+  for _, name := range []string{"Fac", "_Helper"} {
+    if IsOperator(name) { t.Errorf("%s recognized as operator.", name); }
+  }
+}
+
+func TestDiagnosticList(t *testing.T) {
+  dl := NewDiagnosticList();
+  if dl.Err() != nil { t.Error("Empty list reported as error."); }
+  dl.Report(NewDiagnostic(SEV_WARNING, "Careful", nil));
+  if dl.Err() != nil { t.Error("Warning reported as error."); }
+  dl.Report(NewDiagnostic(SEV_ERROR, "Broken", nil));
+  if dl.Len() != 2 || dl.ErrorCount() != 1 || dl.Err() == nil {
+    t.Error("Diagnostics counted wrong.");
+  }
+  if s := dl.String(); s != "warning: Careful\nerror: Broken\n" {
+    t.Errorf("Diagnostics written wrong: `%s`.", s);
+  }
+}
+
+func TestDiagnosticFormats(t *testing.T) {
+  dl := NewDiagnosticList();
+  diag := NewDiagnostic(SEV_ERROR, "Say \"hi\"", nil);
+  diag.AddNote(nil, "Tab\there");
+  dl.Report(diag);
+  json := `[
+  {"severity": "error", "message": "Say \"hi\"", "notes": ` +
+      `[{"severity": "note", "message": "Tab\there"}]}
+]
+`;
+  if s := dl.FormatAs("json", false); s != json {
+    t.Errorf("JSON written wrong: `%s`.", s);
+  }
+  if s := dl.FormatAs("text", false); s != "error: Say \"hi\"\nnote: Tab\there\n" {
+    t.Errorf("Text written wrong: `%s`.", s);
+  }
+  sarif := `{"version": "2.1.0", ` +
+      `"$schema": "https://json.schemastore.org/sarif-2.1.0.json", ` +
+      `"runs": [{"tool": {"driver": {"name": "diamond"}}, "results": [
+  {"level": "error", "message": {"text": "Say \"hi\""}, ` +
+      `"relatedLocations": [{"message": {"text": "Tab\there"}}]}
+]}]}
+`;
+  if s := dl.FormatAs("sarif", false); s != sarif {
+    t.Errorf("SARIF written wrong: `%s`.", s);
+  }
+  if !IsDiagnosticFormat("sarif") || IsDiagnosticFormat("xml") {
+    t.Error("Diagnostic formats not recognized.");
+  }
+}
+
+// testPiece - A piece of a single line that exists only by its name and
+// its columns.
+type testPiece struct {
+  name       string;
+  line       int;
+  start, end int;
+}
+func (tp *testPiece) Start() SrcMark { return SrcMark{nil, tp.start}; }
+func (tp *testPiece) End() SrcMark { return SrcMark{nil, tp.end}; }
+func (tp *testPiece) StartLine() int { return tp.line; }
+func (tp *testPiece) StartColumn() int { return tp.start; }
+func (tp *testPiece) EndLine() int { return tp.line; }
+func (tp *testPiece) EndColumn() int { return tp.end; }
+func (tp *testPiece) FileName() string { return tp.name; }
+func (tp *testPiece) FileID() int { return 0; }
+func (tp *testPiece) Content() string { return ""; }
+func (tp *testPiece) WholeLine() string { return ""; }
+func (tp *testPiece) String() string { return tp.name; }
+func (tp *testPiece) Error(msg string) {}
+func (tp *testPiece) Report(diag *Diagnostic) {}
+func (tp *testPiece) Until(end SrcPiece) SrcPiece {
+  return &testPiece{tp.name, tp.line, tp.start, end.EndColumn()};
+}
+
+func TestDiagnosticLocations(t *testing.T) {
+  dl := NewDiagnosticList();
+  diag := NewDiagnostic(SEV_ERROR, "Bad", &testPiece{"/src/a b.dia", 1, 2, 5});
+  diag.AddNote(&testPiece{"", 0, 0, 1}, "Generated");
+  dl.Report(diag);
+  diag = NewDiagnostic(SEV_WARNING, "Odd", &testPiece{"", 3, 0, 1});
+  diag.AddNote(&testPiece{"/src/ä.dia", 0, 4, 6}, "Here");
+  dl.Report(diag);
+
+  json := `[
+  {"severity": "error", "message": "Bad", "file": "/src/a b.dia", ` +
+      `"start": {"line": 2, "column": 3}, "end": {"line": 2, "column": 6}, ` +
+      `"notes": [{"severity": "note", "message": "Generated", "file": "", ` +
+      `"start": {"line": 1, "column": 1}, "end": {"line": 1, "column": 2}}]},
+  {"severity": "warning", "message": "Odd", "file": "", ` +
+      `"start": {"line": 4, "column": 1}, "end": {"line": 4, "column": 2}, ` +
+      `"notes": [{"severity": "note", "message": "Here", ` +
+      `"file": "/src/ä.dia", "start": {"line": 1, "column": 5}, ` +
+      `"end": {"line": 1, "column": 7}}]}
+]
+`;
+  if s := dl.FormatAs("json", false); s != json {
+    t.Errorf("JSON written wrong: `%s`.", s);
+  }
+  sarif := `{"version": "2.1.0", ` +
+      `"$schema": "https://json.schemastore.org/sarif-2.1.0.json", ` +
+      `"runs": [{"tool": {"driver": {"name": "diamond"}}, "results": [
+  {"level": "error", "message": {"text": "Bad"}, "locations": [` +
+      `{"physicalLocation": {"artifactLocation": ` +
+      `{"uri": "file:///src/a%20b.dia"}, "region": {"startLine": 2, ` +
+      `"startColumn": 3, "endLine": 2, "endColumn": 6}}}], ` +
+      `"relatedLocations": [{"message": {"text": "Generated"}}]},
+  {"level": "warning", "message": {"text": "Odd"}, "relatedLocations": [` +
+      `{"message": {"text": "Here"}, "physicalLocation": ` +
+      `{"artifactLocation": {"uri": "file:///src/%C3%A4.dia"}, ` +
+      `"region": {"startLine": 1, "startColumn": 5, "endLine": 1, ` +
+      `"endColumn": 7}}}]}
+]}]}
+`;
+  if s := dl.FormatAs("sarif", false); s != sarif {
+    t.Errorf("SARIF written wrong: `%s`.", s);
+  }
+}
+
+func TestRunAbortable(t *testing.T) {
+  done := false;
+  if !RunAbortable(nil, func() { done = true; }) || !done {
+    t.Error("Work not finished.");
+  }
+  done = false;
+  piece := &testPiece{"test", 0, 0, 1};
+  if RunAbortable(piece, func() { Abort(piece, "Stop"); done = true; }) ||
+     done {
+    t.Error("Work not aborted.");
+  }
+  if RunAbortable(piece, func() { Any2int(nil); done = true; }) || done {
+    t.Error("Work not aborted by a bug.");
+  }
+
+  defer func() {
+    if err := recover(); err == nil || !done {
+      t.Error("Abort outside of RunAbortable doesn't panic.");
+    }
+  }();
+  done = true;
+  Abort(piece, "Stop");
+  done = false;
+}
+
+func TestStringTypes(t *testing.T) {
+  valid := map[int][]string{
+    'd': []string{"2011-03-21", "2000-02-29"},
+    't': []string{"20:30", "20:30:34.123+0200", "00:00:60Z"},
+    's': []string{"2011-03-21 20:20:34.123"},
+    'u': []string{"http://www.google.com", "mailto:ole@example.com"},
+  };
+  invalid := map[int][]string{
+    'd': []string{"2011-3-21", "1900-02-29", "2011-04-31"},
+    't': []string{"24:00", "20:30:", "20:30.5", "20:30+2", "20:30+1500"},
+    's': []string{"2011-03-21T20:20"},
+    'u': []string{"www.google.com", "http://a b", "1http://a"},
+    'f': []string{""},
+    'r': []string{"(a"},
+  };
+  for prefix, vals := range valid {
+    for _, val := range vals {
+      if err := StringTypeOf(prefix).Validate(val); err != nil {
+        t.Errorf("%s should be valid, but got: %s.", val, err);
+      }
+    }
+  }
+  for prefix, vals := range invalid {
+    for _, val := range vals {
+      if StringTypeOf(prefix).Validate(val) == nil {
+        t.Errorf("%s should be invalid.", val);
+      }
+    }
+  }
+
+  typ, err := RegisterStringType('e', "EMail", false, nil);
+  if err != nil { t.Fatal(err.String()); }
+  if typ.String() != "EMail" || StringTypeOf('e').DataType != typ ||
+     typ < TYPE_FIRST_REGISTERED {
+    t.Errorf("Registered string type %s isn't found.", typ);
+  }
+  if _, err := RegisterStringType('d', "Day", false, nil); err == nil {
+    t.Error("A prefix shouldn't be registered twice.");
+  }
+}
+
+func TestConcurrentStringTypes(t *testing.T) {
+  done := make(chan DataTypeEnum);
+  for i := 0; i < 8; i++ {
+    go func(prefix int) {
+      typ, _ := RegisterStringType(prefix, "Type" + string(prefix), true,
+                                   nil);
+      done <- typ;
+    }('A' + i);
+  }
+  seen := make(map[DataTypeEnum]bool);
+  for i := 0; i < 8; i++ {
+    typ := <-done;
+    if typ < TYPE_FIRST_REGISTERED || seen[typ] {
+      t.Errorf("Data type %d registered wrong.", typ);
+    }
+    seen[typ] = true;
+  }
+}
@@ -0,0 +1,162 @@
+package common
+
+import (
+  "bytes";
+  "fmt";
+  "os";
+  "path";
+  "strings";
+)
+
+
+// --------------------------------------------------------------------------
+// Machine readable diagnostics:
+// --------------------------------------------------------------------------
+
+// The formats the diagnostics can be written in.
+// The text format is the one of Diagnostic.Format.
+var diagnosticFormats = map[string]func(dl *DiagnosticList, color bool) string {
+  "text":  func(dl *DiagnosticList, color bool) string { return dl.Format(color); },
+  "json":  func(dl *DiagnosticList, color bool) string { return dl.JSON(); },
+  "sarif": func(dl *DiagnosticList, color bool) string { return dl.SARIF(); },
+}
+
+func IsDiagnosticFormat(format string) bool {
+  _, ok := diagnosticFormats[format];
+  return ok;
+}
+
+// FormatAs - Return all diagnostics in the given format.
+// Colours are used only by the text format.
+func (dl *DiagnosticList) FormatAs(format string, color bool) string {
+  fn, ok := diagnosticFormats[format];
+  if !ok {
+    panic("Internal error (unknown diagnostics format '" + format + "')!");
+  }
+  return fn(dl, color);
+}
+
+// JSON - Return all diagnostics as JSON array.
+// Lines and columns are counted from 1 and the end is the position
+// of the character after the piece.
+func (dl *DiagnosticList) JSON() string {
+  out := bytes.NewBufferString("[");
+  for i, diag := range dl.Diagnostics() {
+    if i > 0 { out.WriteString(","); }
+    out.WriteString("\n  ");
+    writeJSONDiagnostic(out, diag, true);
+  }
+  if dl.Len() > 0 { out.WriteString("\n"); }
+  out.WriteString("]\n");
+  return out.String();
+}
+
+func writeJSONDiagnostic(out *bytes.Buffer, diag *Diagnostic, withNotes bool) {
+  fmt.Fprintf(out, `{"severity": %s, "message": %s`,
+              jsonString(diag.Severity.String()), jsonString(diag.Msg));
+  if p := diag.Piece; p != nil {
+    fmt.Fprintf(out, `, "file": %s, "start": {"line": %d, "column": %d}` +
+                     `, "end": {"line": %d, "column": %d}`,
+                jsonString(p.FileName()), p.StartLine()+1, p.StartColumn()+1,
+                p.EndLine()+1, p.EndColumn()+1);
+  }
+  if withNotes {
+    out.WriteString(`, "notes": [`);
+    for i, note := range diag.Notes() {
+      if i > 0 { out.WriteString(", "); }
+      writeJSONDiagnostic(out, note, false);
+    }
+    out.WriteString("]");
+  }
+  out.WriteString("}");
+}
+
+// SARIF - Return all diagnostics as SARIF 2.1.0 log with a single run.
+// Notes become related locations of their result.
+// Sources without a name (e.g. generated ones) can't be referenced, so
+// diagnostics about them get no physical location.
+func (dl *DiagnosticList) SARIF() string {
+  out := bytes.NewBufferString(`{"version": "2.1.0", ` +
+      `"$schema": "https://json.schemastore.org/sarif-2.1.0.json", ` +
+      `"runs": [{"tool": {"driver": {"name": "diamond"}}, "results": [`);
+  for i, diag := range dl.Diagnostics() {
+    if i > 0 { out.WriteString(","); }
+    fmt.Fprintf(out, "\n  {\"level\": %s, \"message\": {\"text\": %s}",
+                jsonString(diag.Severity.String()), jsonString(diag.Msg));
+    if hasSARIFLocation(diag.Piece) {
+      out.WriteString(`, "locations": [`);
+      writeSARIFLocation(out, diag.Piece, "");
+      out.WriteString("]");
+    }
+    if notes := diag.Notes(); len(notes) > 0 {
+      out.WriteString(`, "relatedLocations": [`);
+      for j, note := range notes {
+        if j > 0 { out.WriteString(", "); }
+        writeSARIFLocation(out, note.Piece, note.Msg);
+      }
+      out.WriteString("]");
+    }
+    out.WriteString("}");
+  }
+  if dl.Len() > 0 { out.WriteString("\n"); }
+  out.WriteString("]}]}\n");
+  return out.String();
+}
+
+func hasSARIFLocation(piece SrcPiece) bool {
+  return piece != nil && piece.FileName() != "";
+}
+
+func writeSARIFLocation(out *bytes.Buffer, piece SrcPiece, msg string) {
+  out.WriteString("{");
+  if msg != "" {
+    fmt.Fprintf(out, `"message": {"text": %s}`, jsonString(msg));
+    if hasSARIFLocation(piece) { out.WriteString(", "); }
+  }
+  if hasSARIFLocation(piece) {
+    fmt.Fprintf(out, `"physicalLocation": {"artifactLocation": {"uri": %s}, ` +
+                     `"region": {"startLine": %d, "startColumn": %d, ` +
+                     `"endLine": %d, "endColumn": %d}}`,
+                jsonString(fileURI(piece.FileName())),
+                piece.StartLine()+1, piece.StartColumn()+1,
+                piece.EndLine()+1, piece.EndColumn()+1);
+  }
+  out.WriteString("}");
+}
+
+// fileURI - Return the file URI of a file name.
+// Relative names are taken relative to the working directory and all
+// characters that aren't allowed in a path are escaped.
+func fileURI(name string) string {
+  if name[0] != '/' {
+    if wd, err := os.Getwd(); err == nil { name = path.Join(wd, name); }
+  }
+  out := bytes.NewBufferString("file://");
+  for i := 0; i < len(name); i++ {
+    switch c := name[i]; {
+    case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+         strings.Index("/-._~", string(c)) >= 0:
+      out.WriteByte(c);
+    default:
+      fmt.Fprintf(out, "%%%02X", c);
+    }
+  }
+  return out.String();
+}
+
+// jsonString - Return the string quoted for JSON.
+func jsonString(s string) string {
+  out := bytes.NewBufferString(`"`);
+  for _, rune := range s {
+    switch {
+    case rune == '"':  out.WriteString(`\"`);
+    case rune == '\\': out.WriteString(`\\`);
+    case rune == '\n': out.WriteString(`\n`);
+    case rune == '\t': out.WriteString(`\t`);
+    case rune < 0x20:  fmt.Fprintf(out, `\u%04x`, rune);
+    default:           out.WriteString(string(rune));
+    }
+  }
+  out.WriteString(`"`);
+  return out.String();
+}
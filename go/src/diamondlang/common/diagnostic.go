@@ -0,0 +1,266 @@
+package common
+
+import (
+  "container/list";
+  "fmt";
+  "io";
+  "os";
+  "strings";
+  "utf8";
+)
+
+
+// --------------------------------------------------------------------------
+// Diagnostics:
+// --------------------------------------------------------------------------
+
+// Define severities as 'enumeration':
+type SeverityEnum int
+const (
+  SEV_ERROR = iota;
+  SEV_WARNING;
+  SEV_NOTE;
+)
+func (sev SeverityEnum) String() string {
+  ret := "";
+  switch sev {
+  case SEV_ERROR:   ret = "error";
+  case SEV_WARNING: ret = "warning";
+  case SEV_NOTE:    ret = "note";
+  default:          ret = fmt.Sprintf("<SEVERITY %d>", sev);
+  }
+  return ret;
+}
+
+// A Diagnostic is a message about a piece of the source.
+// The piece is nil if the message isn't about a special place.
+// Notes can point to further places that help to understand the message.
+type Diagnostic struct {
+  Severity SeverityEnum;
+  Msg      string;
+  Piece    SrcPiece;
+  notes   *list.List;
+}
+
+func NewDiagnostic(sev SeverityEnum, msg string, piece SrcPiece) *Diagnostic {
+  return &Diagnostic{sev, msg, piece, list.New()};
+}
+
+// AddNote - Add a note about the piece to the diagnostic.
+func (diag *Diagnostic) AddNote(piece SrcPiece, msg string) {
+  diag.notes.PushBack(NewDiagnostic(SEV_NOTE, msg, piece));
+}
+
+func (diag *Diagnostic) Notes() []*Diagnostic {
+  ret := make([]*Diagnostic, diag.notes.Len());
+  i := 0;
+  for e := diag.notes.Front(); e != nil; e = e.Next() {
+    ret[i] = e.Value.(*Diagnostic);
+    i++;
+  }
+  return ret;
+}
+
+func (diag *Diagnostic) String() string { return diag.Format(false); }
+
+// Location - Return the place of the piece as 'file:line:col' with line and
+// column counted from 1 (the file is missing if the source has no name).
+func (diag *Diagnostic) Location() string {
+  if diag.Piece == nil { return ""; }
+  loc := fmt.Sprintf("%d:%d", diag.Piece.StartLine()+1,
+                     diag.Piece.StartColumn()+1);
+  if name := diag.Piece.FileName(); name != "" { loc = name + ":" + loc; }
+  return loc;
+}
+
+// Format - Return the diagnostic in the 'file:line:col: error: msg' format
+// followed by the lines of the piece with carets under the piece.
+// The notes follow in the same format.
+// ANSI colour codes are used if color is true.
+func (diag *Diagnostic) Format(color bool) string {
+  ret := diag.formatMsg(color);
+  for e := diag.notes.Front(); e != nil; e = e.Next() {
+    ret += e.Value.(*Diagnostic).Format(color);
+  }
+  return ret;
+}
+
+func (diag *Diagnostic) formatMsg(color bool) string {
+  sev := diag.Severity.String() + ":";
+  msg := diag.Msg;
+  if color {
+    sev = sevColors[diag.Severity] + sev + ansiReset;
+    msg = ansiBold + msg + ansiReset;
+  }
+  if diag.Piece == nil { return sev + " " + msg + "\n"; }
+
+  loc := diag.Location() + ":";
+  if color { loc = ansiBold + loc + ansiReset; }
+  return loc + " " + sev + " " + msg + "\n" + excerpt(diag.Piece, color);
+}
+
+const (
+  ansiReset = "\x1b[0m";
+  ansiBold  = "\x1b[1m";
+  ansiCaret = "\x1b[1;32m";
+)
+var sevColors = map[SeverityEnum]string {
+  SEV_ERROR:   "\x1b[1;31m",
+  SEV_WARNING: "\x1b[1;35m",
+  SEV_NOTE:    "\x1b[1;36m",
+}
+
+// excerpt - Return the lines of the piece, each followed by a line of carets
+// under the part that belongs to the piece.
+func excerpt(piece SrcPiece, color bool) string {
+  lines := splitLines(piece.WholeLine());
+  last := len(lines) - 1;
+  endCol := piece.EndColumn();
+  if last > 0 && endCol <= 0 {
+    // the piece ends with a line ending, so the last line isn't part of it
+    last--;
+    endCol = utf8.RuneCountInString(lines[last]) + 1;
+  }
+
+  ret := "";
+  for i := 0; i <= last; i++ {
+    start, end := 0, utf8.RuneCountInString(lines[i]);
+    if i == 0 { start = piece.StartColumn(); }
+    if i == last { end = endCol; }
+    if end <= start { end = start + 1; }  // mark at least one character
+    carets := strings.Repeat("^", end - start);
+    if color { carets = ansiCaret + carets + ansiReset; }
+    ret += lines[i] + "\n" + indentation(lines[i], start) + carets + "\n";
+  }
+  return ret;
+}
+
+// splitLines - Split the string at every "\n".
+func splitLines(s string) []string {
+  n := strings.Count(s, "\n") + 1;
+  ret := make([]string, n);
+  for i := 0; i < n-1; i++ {
+    j := strings.Index(s, "\n");
+    ret[i], s = s[0:j], s[j+1:len(s)];
+  }
+  ret[n-1] = s;
+  return ret;
+}
+
+// indentation - Return the blanks that move the carets below column col of
+// the line. Tabs are kept, so the carets line up with the line itself.
+func indentation(line string, col int) string {
+  ret := "";
+  for _, rune := range line {
+    if col <= 0 { break; }
+    if rune == '\t' { ret += "\t"; } else { ret += " "; }
+    col--;
+  }
+  return ret + strings.Repeat(" ", col);
+}
+
+// All diagnostics of a run are reported to a sink.
+type DiagnosticSink interface {
+  Report(diag *Diagnostic);
+}
+
+
+// DiagnosticList - A sink that collects all diagnostics.
+// It is an os.Error itself, so it can be returned to callers (see Err).
+type DiagnosticList struct {
+  diags  *list.List;
+  errors int;
+}
+
+func NewDiagnosticList() *DiagnosticList {
+  return &DiagnosticList{list.New(), 0};
+}
+
+func (dl *DiagnosticList) Report(diag *Diagnostic) {
+  dl.diags.PushBack(diag);
+  if diag.Severity == SEV_ERROR { dl.errors++; }
+}
+
+func (dl *DiagnosticList) Len() int { return dl.diags.Len(); }
+func (dl *DiagnosticList) ErrorCount() int { return dl.errors; }
+
+func (dl *DiagnosticList) Diagnostics() []*Diagnostic {
+  ret := make([]*Diagnostic, dl.diags.Len());
+  i := 0;
+  for e := dl.diags.Front(); e != nil; e = e.Next() {
+    ret[i] = e.Value.(*Diagnostic);
+    i++;
+  }
+  return ret;
+}
+
+func (dl *DiagnosticList) String() string { return dl.Format(false); }
+
+// Format - Return all diagnostics formatted like Diagnostic.Format.
+func (dl *DiagnosticList) Format(color bool) string {
+  ret := "";
+  for e := dl.diags.Front(); e != nil; e = e.Next() {
+    ret += e.Value.(*Diagnostic).Format(color);
+  }
+  return ret;
+}
+
+// Err - return nil if no errors have been reported and the list otherwise.
+func (dl *DiagnosticList) Err() os.Error {
+  if dl.errors <= 0 { return nil; }
+  return dl;
+}
+
+
+// DiagnosticPrinter - A sink that writes every diagnostic immediately.
+type DiagnosticPrinter struct {
+  out   io.Writer;
+  color bool;
+}
+
+func NewDiagnosticPrinter(out io.Writer) *DiagnosticPrinter {
+  return &DiagnosticPrinter{out, false};
+}
+
+// SetColor - Switch ANSI colour codes on or off (they are off by default).
+func (dp *DiagnosticPrinter) SetColor(color bool) {
+  dp.color = color;
+}
+
+func (dp *DiagnosticPrinter) Report(diag *Diagnostic) {
+  fmt.Fprint(dp.out, diag.Format(dp.color));
+}
+
+
+// --------------------------------------------------------------------------
+// Aborting work:
+// --------------------------------------------------------------------------
+
+// abortion - The panic value of Abort (the message of the error).
+type abortion string
+
+// RunAbortable - Run 'work' and return when it is done.
+// The work can be stopped early with Abort.
+// Any other panic of the work (e.g. by Any2int) is a bug; it is reported as
+// internal error at the piece the work is about and stops the work, too.
+// false is returned if the work has been aborted.
+func RunAbortable(piece SrcPiece, work func()) (finished bool) {
+  defer func() {
+    if err := recover(); err != nil {
+      if _, ok := err.(abortion); !ok {
+        piece.Error(fmt.Sprint("Internal error: ", err));
+      }
+      finished = false;
+    }
+  }();
+  work();
+  return true;
+}
+
+// Abort - Report an error at the piece and stop the work started by
+// RunAbortable.
+// Outside of RunAbortable it panics like any other bug.
+func Abort(piece SrcPiece, msg string) {
+  piece.Error(msg);
+  panic(abortion(msg));
+}
@@ -0,0 +1,230 @@
+package common
+
+import (
+  "os";
+  "regexp";
+  "strconv";
+  "sync";
+)
+
+
+// --------------------------------------------------------------------------
+// Typed strings:
+// A string with a letter in front of it (e.g. d"2011-03-21") has its own
+// data type. The letter (prefix) selects the data type from a registry.
+// --------------------------------------------------------------------------
+
+// StringType - A data type for typed strings.
+// Validate returns an error for an invalid string (it can be nil if all
+// strings are valid).
+// Raw strings don't have escape sequences even in double quotes, so a
+// backslash is an ordinary character (e.g. in r"\d+" or f"C:\temp").
+type StringType struct {
+  Prefix   int;
+  DataType DataTypeEnum;
+  Name     string;
+  Raw      bool;
+  Validate func(val string) os.Error;
+}
+
+// The built in string types (by prefix).
+// The registry can be used by several goroutines, so every access has to
+// hold the lock.
+var stringTypes = map[int]*StringType {
+  'd': &StringType{'d', TYPE_DATE,      "Date",      false, validateDate},
+  'f': &StringType{'f', TYPE_FILENAME,  "FileName",  true,  validateFileName},
+  'r': &StringType{'r', TYPE_REGEXP,    "Regexp",    true,  validateRegexp},
+  's': &StringType{'s', TYPE_TIMESTAMP, "Timestamp", false, validateTimestamp},
+  't': &StringType{'t', TYPE_TIME,      "Time",      false, validateTime},
+  'u': &StringType{'u', TYPE_URL,       "URL",       false, validateURL},
+}
+
+// the data type of the next registered string type
+var nextStringType = DataTypeEnum(TYPE_FIRST_REGISTERED)
+
+var stringTypesLock sync.Mutex
+
+// RegisterStringType - Add a string type for a new prefix and return its
+// (new) data type.
+func RegisterStringType(prefix int, name string, raw bool,
+                        validate func(string) os.Error) (DataTypeEnum,
+                                                         os.Error) {
+  if !(prefix >= 'a' && prefix <= 'z' || prefix >= 'A' && prefix <= 'Z') {
+    return TYPE_UNKNOWN, os.NewError("The prefix of a string type has to " +
+                                     "be a letter");
+  }
+  stringTypesLock.Lock();
+  defer stringTypesLock.Unlock();
+  if st, ok := stringTypes[prefix]; ok {
+    return TYPE_UNKNOWN, os.NewError("The prefix '" + string(prefix) +
+                                     "' is used by " + st.Name + " already");
+  }
+  if stringTypeNamed(name) != nil {
+    return TYPE_UNKNOWN, os.NewError("The string type " + name +
+                                     " exists already");
+  }
+  st := &StringType{prefix, nextStringType, name, raw, validate};
+  stringTypes[prefix] = st;
+  nextStringType++;
+  return st.DataType, nil;
+}
+
+// StringTypeOf - Return the string type of a prefix or nil.
+func StringTypeOf(prefix int) *StringType {
+  stringTypesLock.Lock();
+  defer stringTypesLock.Unlock();
+  st, ok := stringTypes[prefix];
+  if !ok { return nil; }
+  return st;
+}
+
+// StringTypeNamed - Return the string type with the given name or nil.
+func StringTypeNamed(name string) *StringType {
+  stringTypesLock.Lock();
+  defer stringTypesLock.Unlock();
+  return stringTypeNamed(name);
+}
+
+// stringTypeNamed - The same as StringTypeNamed for callers that hold the
+// lock already.
+func stringTypeNamed(name string) *StringType {
+  for _, st := range stringTypes {
+    if st.Name == name { return st; }
+  }
+  return nil;
+}
+
+// StringType - Return the string type of the data type or nil if it isn't
+// a typed string.
+func (dt DataTypeEnum) StringType() *StringType {
+  stringTypesLock.Lock();
+  defer stringTypesLock.Unlock();
+  for _, st := range stringTypes {
+    if st.DataType == dt { return st; }
+  }
+  return nil;
+}
+
+
+// --------------------------------------------------------------------------
+// Validation of the built in string types:
+// --------------------------------------------------------------------------
+
+// validateDate - A date is written as YYYY-MM-DD.
+func validateDate(val string) os.Error {
+  if !hasPattern(val, "dddd-dd-dd") {
+    return os.NewError("expected YYYY-MM-DD");
+  }
+  year, month, day := digits(val[0:4]), digits(val[5:7]), digits(val[8:10]);
+  if month < 1 || month > 12 { return os.NewError("invalid month"); }
+  if day < 1 || day > daysOfMonth(year, month) {
+    return os.NewError("invalid day");
+  }
+  return nil;
+}
+
+func daysOfMonth(year int, month int) int {
+  switch month {
+  case 2:
+    if year % 4 == 0 && (year % 100 != 0 || year % 400 == 0) { return 29; }
+    return 28;
+  case 4, 6, 9, 11:
+    return 30;
+  }
+  return 31;
+}
+
+// validateTime - A time is written as HH:MM with optional seconds
+// (:SS or :SS.fff) and an optional time zone (Z, +HHMM or -HHMM).
+func validateTime(val string) os.Error {
+  if len(val) < 5 || !hasPattern(val[0:5], "dd:dd") {
+    return os.NewError("expected HH:MM");
+  }
+  if digits(val[0:2]) > 23 || digits(val[3:5]) > 59 {
+    return os.NewError("invalid hour or minute");
+  }
+  rest := val[5:len(val)];
+  if len(rest) > 0 && rest[0] == ':' {
+    if len(rest) < 3 || !hasPattern(rest[0:3], ":dd") ||
+       digits(rest[1:3]) > 60                          {  // leap second
+      return os.NewError("invalid seconds");
+    }
+    rest = rest[3:len(rest)];
+    if len(rest) > 0 && rest[0] == '.' {
+      i := 1;
+      for i < len(rest) && isDigit(rest[i]) { i++; }
+      if i == 1 { return os.NewError("missing fraction of the seconds"); }
+      rest = rest[i:len(rest)];
+    }
+  }
+  if rest != "" && rest != "Z" &&
+     (!hasPattern(rest, "+dddd") && !hasPattern(rest, "-dddd") ||
+      digits(rest[1:3]) > 14 || digits(rest[3:5]) > 59)           {
+    return os.NewError("invalid time zone");
+  }
+  return nil;
+}
+
+// validateTimestamp - A time stamp is a date and a time separated by a
+// space (e.g. 2011-03-21 20:20:34.123).
+func validateTimestamp(val string) os.Error {
+  if len(val) < 11 || val[10] != ' ' {
+    return os.NewError("expected YYYY-MM-DD HH:MM");
+  }
+  if err := validateDate(val[0:10]); err != nil { return err; }
+  return validateTime(val[11:len(val)]);
+}
+
+func validateFileName(val string) os.Error {
+  if val == "" { return os.NewError("empty file name"); }
+  for _, ch := range val {
+    if ch == 0 || ch == '\n' || ch == '\r' {
+      return os.NewError("invalid character in file name");
+    }
+  }
+  return nil;
+}
+
+func validateRegexp(val string) os.Error {
+  _, err := regexp.Compile(val);
+  return err;
+}
+
+// validateURL - An URL (or URI) needs a scheme and may not contain any space.
+func validateURL(val string) os.Error {
+  i := 0;
+  for ; i < len(val) && val[i] != ':'; i++ {
+    ch := val[i];
+    if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' ||
+         i > 0 && (isDigit(ch) || ch == '+' || ch == '-' || ch == '.')) {
+      return os.NewError("invalid scheme");
+    }
+  }
+  if i == 0 || i >= len(val)-1 {
+    return os.NewError("expected scheme:rest (e.g. http://...)");
+  }
+  for _, ch := range val {
+    if ch <= ' ' { return os.NewError("URLs can't contain spaces"); }
+  }
+  return nil;
+}
+
+// hasPattern - Check whether the string matches the pattern character by
+// character where 'd' matches any digit.
+func hasPattern(val string, pattern string) bool {
+  if len(val) != len(pattern) { return false; }
+  for i := 0; i < len(val); i++ {
+    if pattern[i] == 'd' && !isDigit(val[i]) ||
+       pattern[i] != 'd' && pattern[i] != val[i] {
+      return false;
+    }
+  }
+  return true;
+}
+
+func isDigit(ch byte) bool { return ch >= '0' && ch <= '9'; }
+
+func digits(val string) int {
+  ret, _ := strconv.Atoi(val);
+  return ret;
+}
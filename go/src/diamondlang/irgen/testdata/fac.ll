@@ -0,0 +1,45 @@
+; ModuleID = 'fac'
+
+declare i64 @Putchar(i32)
+
+define i64 @Fac(i64 %n) {
+entry:
+  %t.4 = icmp eq i64 %n, 0
+  br i1 %t.4, label %then.2, label %else.3
+then.2:
+  br label %endif.1
+else.3:
+  %t.5 = sub i64 %n, 1
+  %t.6 = call i64 @Fac(i64 %t.5)
+  %t.7 = mul i64 %n, %t.6
+  br label %endif.1
+endif.1:
+  %t.8 = phi i64 [ 1, %then.2 ], [ %t.7, %else.3 ]
+  ret i64 %t.8
+}
+
+define i32 @Sign(i64 %n) {
+entry:
+  %t.4 = icmp slt i64 %n, 0
+  br i1 %t.4, label %then.2, label %else.3
+then.2:
+  br label %endif.1
+else.3:
+  %t.7 = icmp sgt i64 %n, 0
+  br i1 %t.7, label %then.5, label %else.6
+then.5:
+  br label %endif.1
+else.6:
+  br label %endif.1
+endif.1:
+  %t.8 = phi i32 [ 110, %then.2 ], [ 112, %then.5 ], [ 122, %else.6 ]
+  ret i32 %t.8
+}
+
+define i64 @Main() {
+entry:
+  %t.1 = call i64 @Fac(i64 5)
+  %t.2 = call i32 @Sign(i64 %t.1)
+  %t.3 = call i64 @Putchar(i32 %t.2)
+  ret i64 %t.1
+}
@@ -0,0 +1,27 @@
+; ModuleID = 'floats'
+
+define double @Area(double %r) {
+entry:
+  %t.1 = fmul double 0x400C000000000000, %r
+  %t.2 = fmul double %t.1, %r
+  %t.3 = fsub double %t.2, 0x3FB999999999999A
+  ret double %t.3
+}
+
+define i1 @Less(double %a, double %b) {
+entry:
+  %t.1 = fcmp olt double %a, %b
+  br i1 %t.1, label %endbool.3, label %rhs.2
+rhs.2:
+  %t.4 = fcmp oeq double %a, 0x408F400000000000
+  br label %endbool.3
+endbool.3:
+  %t.5 = phi i1 [ true, %entry ], [ %t.4, %rhs.2 ]
+  ret i1 %t.5
+}
+
+define i1 @Differ(double %a, double %b) {
+entry:
+  %t.1 = fcmp une double %a, %b
+  ret i1 %t.1
+}
@@ -0,0 +1,69 @@
+; ModuleID = 'ops'
+
+define i1 @Between(i64 %x) {
+entry:
+  %t.1 = icmp sge i64 %x, 3
+  br i1 %t.1, label %rhs.2, label %endbool.3
+rhs.2:
+  %t.4 = icmp slt i64 %x, 7
+  br label %endbool.3
+endbool.3:
+  %t.5 = phi i1 [ false, %entry ], [ %t.4, %rhs.2 ]
+  br i1 %t.5, label %endbool.7, label %rhs.6
+rhs.6:
+  %t.8 = icmp ne i64 %x, 0
+  %t.9 = xor i1 %t.8, true
+  br label %endbool.7
+endbool.7:
+  %t.10 = phi i1 [ true, %endbool.3 ], [ %t.9, %rhs.6 ]
+  ret i1 %t.10
+}
+
+define i64 @Power(i64 %b, i64 %e) {
+entry:
+  br label %pow.1
+pow.1:
+  %t.4 = phi i64 [ 1, %entry ], [ %t.6, %powbody.2 ]
+  %t.5 = phi i64 [ %e, %entry ], [ %t.7, %powbody.2 ]
+  %t.8 = icmp sgt i64 %t.5, 0
+  br i1 %t.8, label %powbody.2, label %endpow.3
+powbody.2:
+  %t.6 = mul i64 %t.4, %b
+  %t.7 = sub i64 %t.5, 1
+  br label %pow.1
+endpow.3:
+  ret i64 %t.4
+}
+
+define i16 @SmallPower(i16 %b, i16 %e) {
+entry:
+  br label %pow.1
+pow.1:
+  %t.4 = phi i16 [ 1, %entry ], [ %t.6, %powbody.2 ]
+  %t.5 = phi i16 [ %e, %entry ], [ %t.7, %powbody.2 ]
+  %t.8 = icmp sgt i16 %t.5, 0
+  br i1 %t.8, label %powbody.2, label %endpow.3
+powbody.2:
+  %t.6 = mul i16 %t.4, %b
+  %t.7 = sub i16 %t.5, 1
+  br label %pow.1
+endpow.3:
+  %t.9 = mul i16 %t.4, 2
+  ret i16 %t.9
+}
+
+define i1 @Ordered(i32 %a, i32 %b) {
+entry:
+  %t.1 = icmp ule i32 %a, %b
+  ret i1 %t.1
+}
+
+define i64 @Steps(i64 %n) {
+entry:
+  %t.1 = sdiv i64 %n, 2
+  %t.2 = srem i64 %n, 2
+  %t.3 = mul i64 %t.1, 2
+  %t.4 = add i64 %t.3, %t.2
+  %t.5 = sub i64 %t.4, %n
+  ret i64 %t.5
+}
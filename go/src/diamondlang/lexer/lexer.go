@@ -13,17 +13,70 @@ type Lexer struct {
   srcBuf      common.SrcBuffer; // our source for characters, ...
   parenStack  []byte;  // for handling nested parentheses
   inParens    int;     // (how deep) are we inside parentheses?
-  curChar     byte;
+  strDelims   []int;   // delimiters of strings around embedded expressions
+  curChar     int;     // the current rune
+  failed      bool;    // did we report an error for the current token?
+  tabSize     int;     // columns of a tab (can be changed by a pragma)
+  strict      bool;    // reject indentation with tabs and spaces mixed?
+  indentChar  int;     // ' ' or '\t' used for indentation so far (or 0)
+  firstLine   int;     // number of the first line of the source (for pragmas)
 }
 
 func NewLexer(sb common.SrcBuffer) common.Lexer {
-  lx := &Lexer{sb, new([MAX_PARENS]byte), 0, 254};
+  lx := &Lexer{sb, new([MAX_PARENS]byte), 0, new([MAX_PARENS]int), 254,
+               false, common.TABSIZE, common.STRICT_INDENT, 0, 0};
   lx.nextChar();
+  // the source can start at any line (see srcbuf.SetFirstLine)
+  lx.firstLine = sb.NewAnyPiece(sb.NewMark(), sb.NewMark()).StartLine();
   return lx;
 }
 
+// SetTabSize - Use another number of columns for a tab than common.TABSIZE.
+// A pragma of the source still overrides it.
+func (lx *Lexer) SetTabSize(size int) { lx.tabSize = size; }
+
+// SetStrictIndent - Switch the check of indentation (see checkIndentation)
+// on or off. A pragma of the source can still switch it on.
+func (lx *Lexer) SetStrictIndent(strict bool) { lx.strict = strict; }
+
+// State - The part of the lexer's state that is carried from one line to
+// the next. It allows to lex a source again from the start of any line.
+type State struct {
+  tabSize    int;
+  strict     bool;
+  indentChar int;
+}
+
+// LineStartState - Return the state of the lexer if it is at the start of
+// a line outside of any parentheses (so no token continues in this line)
+// and nil otherwise.
+func (lx *Lexer) LineStartState() *State {
+  if !lx.srcBuf.AtStartOfLine() || lx.inParens > 0 { return nil; }
+  return &State{lx.tabSize, lx.strict, lx.indentChar};
+}
+
+// SetState - Continue with the state of another lexer at the start of a line.
+func (lx *Lexer) SetState(st *State) {
+  lx.tabSize, lx.strict, lx.indentChar = st.tabSize, st.strict, st.indentChar;
+}
+
+func (st *State) Equals(other *State) bool {
+  return st.tabSize == other.tabSize && st.strict == other.strict &&
+         st.indentChar == other.indentChar;
+}
+
+// Error - Report an error about the current character.
+// Only the first error of a token is reported because the rest of the
+// token is skipped (see GetToken).
 func (lx *Lexer) Error(msg string) {
-  lx.srcBuf.Error(msg);
+  if !lx.failed { lx.srcBuf.Error(msg); }
+  lx.failed = true;
+}
+
+// errorAt - Report an error about a piece of the source just like Error.
+func (lx *Lexer) errorAt(piece common.SrcPiece, msg string) {
+  if !lx.failed { piece.Error(msg); }
+  lx.failed = true;
 }
 
 func (lx *Lexer) ClearUpTo(mark common.SrcMark) {
@@ -40,7 +93,7 @@ func (lx *Lexer) prevChar() {
   lx.curChar = lx.srcBuf.Getch();
 }
 
-func openParen(ch byte, lx *Lexer) byte {
+func openParen(ch int, lx *Lexer) byte {
   var ret byte;
   switch ch {
     case ')': ret = '(';
@@ -63,19 +116,48 @@ func (lx *Lexer) GetToken() common.Token {
       tryNumber, tryOperator, tryId, tryChar, tryString, signalUndefined
   };
 
+  mark := lx.srcBuf.NewMark();
+  lx.failed = false;
   tok = lx.getFirstTok(lxFuncs);
 //fmt.Println(">>> Got token:", tok.Type(), tok);
+  if lx.failed { tok = lx.resync(mark); }
 
   return tok;
 }
 
+// resync - Skip the rest of a bad token up to the next white space or new
+// line, so lexing can go on after an error.
+// Inside of an embedded expression the closing brace stops it, too, and
+// parentheses that are still open in the expression are dropped. So the
+// rest of the string is read as usual.
+// The error token covers the whole bad token.
+func (lx *Lexer) resync(mark common.SrcMark) common.Token {
+  embed := lx.innerEmbedding();
+  for !common.IsSpace(lx.curChar) && lx.curChar != '\n' &&
+      lx.curChar != '\r' && lx.curChar != common.EOF &&
+      !(lx.curChar == '}' && embed >= 0) {
+    lx.nextChar();
+  }
+  if lx.curChar == '}' && embed >= 0 { lx.inParens = embed + 1; }
+  return lx.newToken(common.TOK_ERROR, mark);
+}
+
+// innerEmbedding - Return the index of the innermost embedded expression on
+// the stack of parentheses or -1 if we aren't inside of one.
+func (lx *Lexer) innerEmbedding() int {
+  for i := lx.inParens - 1; i >= 0; i-- {
+    if lx.parenStack[i] == EMBED_PAREN { return i; }
+  }
+  return -1;
+}
+
 func (lx *Lexer) getFirstTok(lxFuncs []lexFunc) common.Token {
   tok := common.Token(nil);
   moved := false;
 
-  // move until a token is found:
+  // move until a token is found (or an error):
   N := len(lxFuncs);
-  for tok == nil {
+  for tok == nil && !lx.failed {
     moved = false;
     for i := 0; !moved && i < N; i++ {
       tok, moved = lxFuncs[i](lx);
@@ -83,4 +165,3 @@ func (lx *Lexer) getFirstTok(lxFuncs []lexFunc) common.Token {
   }
   return tok;
 }
-
@@ -90,6 +90,86 @@ func TestNumsParensOps(t *testing.T) {
   testStringVsTokens(t, testStr, testToks);
 }
 
+func TestBigInts(t *testing.T) {
+  testStr := "123_456_789_012_345_678_901_234 0xFFInt1 7Int";
+  lx := NewLexer(srcbuf.NewSourceFromBuffer(strings.Bytes(testStr), "test"));
+
+  expected := []struct { val string; suffix string; }{
+    {"123456789012345678901234", ""}, {"255", "Int1"}, {"7", "Int"},
+  };
+  for i, exp := range expected {
+    tok := lx.GetToken();
+    for ; tok.Type() == common.TOK_SPACE; tok = lx.GetToken() {}
+    it, ok := tok.(*IntTok);
+    if !ok {
+      t.Errorf("%d: Expected an integer token, but got: %v.", i, tok);
+      continue;
+    }
+    if it.Value().String() != exp.val || it.Suffix() != exp.suffix {
+      t.Errorf("%d: Expected %s%s, but got: %s%s.", i, exp.val, exp.suffix,
+               it.Value().String(), it.Suffix());
+    }
+  }
+}
+
+func TestUnknownIntSuffix(t *testing.T) {
+  testStr := "3Foo 4Int9";
+  testToks := []*tstTok{
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_INT, "3", false, 3, ""},
+    &tstTok{common.TOK_FUNC_ID, "Foo", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_INT, "4", false, 4, ""},
+    &tstTok{common.TOK_FUNC_ID, "Int9", true, 0, ""},
+  };
+
+  testStringVsTokens(t, testStr, testToks);
+}
+
+func TestFloats(t *testing.T) {
+  testStr := "1.5 0x1.8p-2 2E3 1_0.2_5e+1 0x1F 7.Print";
+  lx := NewLexer(srcbuf.NewSourceFromBuffer(strings.Bytes(testStr), "test"));
+
+  expected := []float64{1.5, 0.375, 2000, 102.5};
+  for i, exp := range expected {
+    tok := lx.GetToken();
+    for ; tok.Type() == common.TOK_SPACE; tok = lx.GetToken() {}
+    if ft, ok := tok.(*FloatTok); !ok || ft.Value() != exp {
+      t.Errorf("%d: Expected float %v, but got: %v.", i, exp, tok);
+    }
+  }
+  for _, exp := range []int64{31, 7} {
+    tok := lx.GetToken();
+    for ; tok.Type() == common.TOK_SPACE; tok = lx.GetToken() {}
+    if it, ok := tok.(*IntTok); !ok || it.Value().Int64() != exp {
+      t.Errorf("Expected integer %d, but got: %v.", exp, tok);
+    }
+  }
+}
+
+func TestTypedStrings(t *testing.T) {
+  testStr := "d\"2011-03-21\" r`a\\d` x y\"\" " +
+             "r\"\\d+\" f\"C:\\temp\" u\"a\\tb\"";
+  lx := NewLexer(srcbuf.NewSourceFromBuffer(strings.Bytes(testStr), "test"));
+
+  expected := []struct { prefix int; val string; }{
+    {'d', "2011-03-21"}, {'r', "a\\d"}, {0, "x"}, {'y', ""},
+    {'r', "\\d+"}, {'f', "C:\\temp"}, {'u', "a\tb"},
+  };
+  for i, exp := range expected {
+    tok := lx.GetToken();
+    for ; tok.Type() == common.TOK_SPACE; tok = lx.GetToken() {}
+    if exp.prefix == 0 {
+      if tok.Type() != common.TOK_MODULE_ID || tok.Content() != exp.val {
+        t.Errorf("%d: Expected ID %s, but got: %v.", i, exp.val, tok);
+      }
+    } else if st, ok := tok.(*TypedStringTok);
+              !ok || st.Prefix() != exp.prefix || st.Value() != exp.val {
+      t.Errorf("%d: Expected %c%q, but got: %v.", i, exp.prefix, exp.val, tok);
+    }
+  }
+}
+
 func TestIdsIndent(t *testing.T) {
   testStr := `If bla > 0:
     mod.Func mod.CONST mod.CONST.val Fn i
@@ -167,6 +247,66 @@ bla = 0
   testStringVsTokens(t, testStr, testToks);
 }
 
+func TestKeywords(t *testing.T) {
+  testStr := `def Fac:Int n:Int
+extern Putchar
+import "diamond/io"
+bind shadowed io Print
+shelf "Math"
+define Def bind.x`;
+
+  testToks := []*tstTok{
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_DEF, "def", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_FUNC_ID, "Fac", true, 0, ""},
+    &tstTok{common.TOK_COLON, ":", true, 0, ""},
+    &tstTok{common.TOK_FUNC_ID, "Int", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_MODULE_ID, "n", true, 0, ""},
+    &tstTok{common.TOK_COLON, ":", true, 0, ""},
+    &tstTok{common.TOK_FUNC_ID, "Int", true, 0, ""},
+    &tstTok{common.TOK_NL, "\n", false, 0, ""},
+
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_EXTERN, "extern", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_FUNC_ID, "Putchar", true, 0, ""},
+    &tstTok{common.TOK_NL, "\n", false, 0, ""},
+
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_IMPORT, "import", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_STR, "\"diamond/io\"", true, 0, "diamond/io"},
+    &tstTok{common.TOK_NL, "\n", false, 0, ""},
+
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_BIND, "bind", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_SHADOWED, "shadowed", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_MODULE_ID, "io", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_FUNC_ID, "Print", true, 0, ""},
+    &tstTok{common.TOK_NL, "\n", false, 0, ""},
+
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_SHELF, "shelf", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_STR, "\"Math\"", true, 0, "Math"},
+    &tstTok{common.TOK_NL, "\n", false, 0, ""},
+
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_MODULE_ID, "define", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_FUNC_ID, "Def", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_VAL_ID, "bind.x", true, 0, ""},
+  };
+
+  testStringVsTokens(t, testStr, testToks);
+}
+
 func TestCharsStrings(t *testing.T) {
   testStr := "'c'    'h' '\\t' '\\a' '\\r' '\\n' \n"
              "\"bla\\r\\n\" \"blue\\t\\a\\0\\n\" \n"
@@ -220,8 +360,205 @@ func TestCharsStrings(t *testing.T) {
   testStringVsTokens(t, testStr, testToks);
 }
 
+func TestEmbeddedExpressions(t *testing.T) {
+  testStr := "\"Hi {name}!\" \"{Fn \"x{y}\"}b{n}\" \"\\{no}\" `raw {x}`\n"
+             "\"\"\"a{b}\n\"\"\"";
+
+  testToks := []*tstTok{
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_STR_START, "\"Hi {", true, 0, "Hi "},
+    &tstTok{common.TOK_MODULE_ID, "name", true, 0, ""},
+    &tstTok{common.TOK_STR_END, "}!\"", true, 0, "!"},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_STR_START, "\"{", true, 0, ""},
+    &tstTok{common.TOK_FUNC_ID, "Fn", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_STR_START, "\"x{", true, 0, "x"},
+    &tstTok{common.TOK_MODULE_ID, "y", true, 0, ""},
+    &tstTok{common.TOK_STR_END, "}\"", true, 0, ""},
+    &tstTok{common.TOK_STR_MIDDLE, "}b{", true, 0, "b"},
+    &tstTok{common.TOK_MODULE_ID, "n", true, 0, ""},
+    &tstTok{common.TOK_STR_END, "}\"", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_STR, "\"\\{no}\"", true, 0, "{no}"},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_STR, "`raw {x}`", true, 0, "raw {x}"},
+    &tstTok{common.TOK_NL, "\n", false, 0, ""},
+
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_STR_START, "\"\"\"a{", true, 0, "a"},
+    &tstTok{common.TOK_MODULE_ID, "b", true, 0, ""},
+    &tstTok{common.TOK_STR_END, "}\n\"\"\"", true, 0, "\n"},
+  };
+
+  testStringVsTokens(t, testStr, testToks);
+}
+
+func TestErrorInEmbeddedExpression(t *testing.T) {
+  testStr := "\"a{@}b\" \"c{(x @}d\" x";
+
+  testToks := []*tstTok{
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_STR_START, "\"a{", true, 0, "a"},
+    &tstTok{common.TOK_ERROR, "@", true, 0, ""},
+    &tstTok{common.TOK_STR_END, "}b\"", true, 0, "b"},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_STR_START, "\"c{", true, 0, "c"},
+    &tstTok{common.TOK_PAREN_OPEN, "(", true, 0, ""},
+    &tstTok{common.TOK_MODULE_ID, "x", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_ERROR, "@", true, 0, ""},
+    &tstTok{common.TOK_STR_END, "}d\"", true, 0, "d"},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_MODULE_ID, "x", true, 0, ""},
+  };
+
+  testStringVsTokens(t, testStr, testToks);
+}
+
+func TestUnicode(t *testing.T) {
+  testStr := "# Grüße aus Köln\n"
+             "\"Straße\" ```Maß``` 'x'";
+
+  testToks := []*tstTok{
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_COMMENT, "# Grüße aus Köln", true, 0, ""},
+    &tstTok{common.TOK_NL, "\n", false, 0, ""},
+
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_STR, "\"Straße\"", true, 0, "Straße"},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_STR, "```Maß```", true, 0, "Maß"},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_CHAR, "'x'", true, int64('x'), ""},
+  };
+
+  testStringVsTokens(t, testStr, testToks);
+}
+
+func TestEscapes(t *testing.T) {
+  testStr := "'\\65' '\\x4a' '\\u{20ac}' 'ä' \"\\x48i\\u{1F600}\\0\\255x\\{\"";
+
+  testToks := []*tstTok{
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_CHAR, "'\\65'", true, 65, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_CHAR, "'\\x4a'", true, 0x4a, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_CHAR, "'\\u{20ac}'", true, 0x20ac, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_CHAR, "'ä'", true, 0xe4, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_STR, "", false, 0, "Hi\U0001f600\x00ÿx{"},
+  };
+  testStringVsTokens(t, testStr, testToks);
+
+  sb := srcbuf.NewSourceFromBuffer(strings.Bytes(
+            "'\\xg' \"\\u{110000}\" '\\u20ac' '\\u{d800}'"), "test");
+  diags := common.NewDiagnosticList();
+  sb.SetDiagnosticSink(diags);
+  lx := NewLexer(sb);
+  for tok := lx.GetToken(); tok.Type() != common.TOK_EOF; tok = lx.GetToken() {
+    if tok.Type() != common.TOK_ERROR && tok.Type() != common.TOK_SPACE {
+      t.Errorf("Expected an error token, but got: %v.", tok);
+    }
+  }
+  if diags.Len() != 4 {
+    t.Errorf("Expected 4 errors, but got:\n%s", diags);
+  }
+}
+
+func TestErrors(t *testing.T) {
+  testStr := "Foo @bar 0r99 x\n)\nBar";
+
+  testToks := []*tstTok{
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_FUNC_ID, "Foo", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_ERROR, "@bar", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_ERROR, "0r99", true, 0, ""},
+    &tstTok{common.TOK_SPACE, " ", true, 1, ""},
+    &tstTok{common.TOK_MODULE_ID, "x", true, 0, ""},
+    &tstTok{common.TOK_NL, "\n", false, 0, ""},
+
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_ERROR, ")", true, 0, ""},
+    &tstTok{common.TOK_NL, "\n", false, 0, ""},
+
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_FUNC_ID, "Bar", true, 0, ""},
+  };
+  expectedErrs := []string{
+    "Unknown token", "Invalid integer base", "Too many closing parentheses",
+  };
+  expectedLines := []int{0, 0, 1};
+
+  sb := srcbuf.NewSourceFromBuffer(strings.Bytes(testStr), "test");
+  diags := common.NewDiagnosticList();
+  sb.SetDiagnosticSink(diags);
+  testLexerVsTokens(t, NewLexer(sb), testToks);
+
+  if diags.Len() != len(expectedErrs) {
+    t.Fatalf("Expected %d errors, but got:\n%s", len(expectedErrs), diags);
+  }
+  for i, diag := range diags.Diagnostics() {
+    if diag.Msg != expectedErrs[i] || diag.Piece.StartLine() != expectedLines[i] {
+      t.Errorf("Expected error `%s` in line %d, but got:\n%s",
+               expectedErrs[i], expectedLines[i]+1, diag);
+    }
+  }
+}
+
+func TestTabSize(t *testing.T) {
+  testStr := "# diamond: tabsize=2\n\tx";
+
+  testToks := []*tstTok{
+    &tstTok{common.TOK_SPACE, "", true, 1000, ""},
+    &tstTok{common.TOK_COMMENT, "# diamond: tabsize=2", true, 0, ""},
+    &tstTok{common.TOK_NL, "\n", false, 0, ""},
+
+    &tstTok{common.TOK_SPACE, "\t", true, 1002, ""},
+    &tstTok{common.TOK_MODULE_ID, "x", true, 0, ""},
+  };
+
+  testStringVsTokens(t, testStr, testToks);
+
+  sb := srcbuf.NewSourceFromBuffer(strings.Bytes(testStr), "test");
+  sb.SetFirstLine(7);
+  testLexerVsTokens(t, NewLexer(sb), testToks);
+}
+
+func TestStrictIndentation(t *testing.T) {
+  testStr := "# diamond: strict-indent tabsize=x foo\n\tx\n \tx\n    x\n\n  # ok\n";
+  expectedErrs := []string{
+    "Invalid tab size in pragma: tabsize=x", "Unknown pragma setting: foo",
+    "Indentation mixes tabs and spaces",
+    "Indentation uses tabs and spaces in different lines",
+  };
+
+  sb := srcbuf.NewSourceFromBuffer(strings.Bytes(testStr), "test");
+  diags := common.NewDiagnosticList();
+  sb.SetDiagnosticSink(diags);
+  lx := NewLexer(sb);
+  for tok := lx.GetToken(); tok.Type() != common.TOK_EOF; tok = lx.GetToken() { }
+
+  if diags.Len() != len(expectedErrs) {
+    t.Fatalf("Expected %d errors, but got:\n%s", len(expectedErrs), diags);
+  }
+  for i, diag := range diags.Diagnostics() {
+    if diag.Msg != expectedErrs[i] {
+      t.Errorf("Expected error `%s`, but got:\n%s", expectedErrs[i], diag);
+    }
+  }
+}
+
 func testStringVsTokens(t *testing.T, str string, toks []*tstTok) {
-  lx := NewLexer(srcbuf.NewSourceFromBuffer(strings.Bytes(str)));
+  sb := srcbuf.NewSourceFromBuffer(strings.Bytes(str), "test");
+  testLexerVsTokens(t, NewLexer(sb), toks);
+}
+
+func testLexerVsTokens(t *testing.T, lx common.Lexer, toks []*tstTok) {
   var tok common.Token;
   var i   int;
   for tok, i = lx.GetToken(), 0; tok.Type() != common.TOK_EOF && i < len(toks);
@@ -231,7 +568,7 @@ func testStringVsTokens(t *testing.T, str string, toks []*tstTok) {
       if toks[i].typ != typ.Type() {
         t.Errorf("Expected token type %v, but got: %v.\n", toks[i].typ, typ.Type());
       }
-      if toks[i].numVal != typ.Value() {
+      if toks[i].numVal != typ.Value().Int64() {
         t.Errorf("Expected value %v, but got: %v.\n", toks[i].numVal, typ.Value());
       }
     case *CharTok:
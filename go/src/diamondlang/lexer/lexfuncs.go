@@ -2,6 +2,9 @@ package lexer
 
 import (
   "diamondlang/common";
+  "big";
+  "math";
+  "os";
   "strings";
   "strconv";
 //"fmt";
@@ -14,7 +17,9 @@ func trySpace(lx *Lexer) (tok common.Token, moved bool) {
   atStart := lx.srcBuf.AtStartOfLine() && lx.inParens <= 0;
   if common.IsSpace(lx.curChar) || atStart {
     mark := lx.srcBuf.NewMark();
-    tok, moved = lx.newSpaceTok(mark, countSpaces(lx), atStart), true;
+    spaces := countSpaces(lx);
+    if atStart && lx.strict { checkIndentation(lx, lx.srcBuf.NewPiece(mark)); }
+    tok, moved = lx.newSpaceTok(mark, spaces, atStart), true;
     lx.srcBuf.NotAtStartOfLine();
   }
   return;
@@ -23,11 +28,37 @@ func trySpace(lx *Lexer) (tok common.Token, moved bool) {
 func countSpaces(lx *Lexer) int {
   spaces := 0;
   for ; common.IsSpace(lx.curChar); lx.nextChar() {
-    spaces += common.SpaceAmount(lx.curChar);
+    if lx.curChar == '\t' {
+      spaces += lx.tabSize;
+    } else {
+      spaces += common.SpaceAmount(lx.curChar);
+    }
   }
   return spaces;
 }
 
+// checkIndentation - In strict mode a line may be indented either with tabs
+// or with blanks and all lines of the source have to use the same.
+// Empty lines and lines with only a comment don't matter.
+func checkIndentation(lx *Lexer, indent common.SrcPiece) {
+  if lx.curChar == '\n' || lx.curChar == '\r' || lx.curChar == '#' ||
+     lx.curChar == common.EOF {
+    return;
+  }
+  str := indent.Content();
+  tabs, blanks := strings.Index(str, "\t") >= 0, strings.Index(str, " ") >= 0;
+  switch {
+  case tabs && blanks:
+    indent.Error("Indentation mixes tabs and spaces");
+  case tabs && lx.indentChar == ' ', blanks && lx.indentChar == '\t':
+    indent.Error("Indentation uses tabs and spaces in different lines");
+  case tabs:
+    lx.indentChar = '\t';
+  case blanks:
+    lx.indentChar = ' ';
+  }
+}
+
 func tryId(lx *Lexer) (tok common.Token, moved bool) {
   if lx.curChar == '\\' {
     lx.nextChar();
@@ -40,18 +71,46 @@ func tryId(lx *Lexer) (tok common.Token, moved bool) {
 
   if isIdStartChar(lx.curChar) {
     fullId := readFullId(lx);
+    if typ, ok := keywords[fullId.Content()]; ok {
+      return &SimpleToken{typ, fullId}, true;
+    }
+    if isStringPrefix(fullId.Content(), lx) {
+      return readTypedString(fullId, lx), true;
+    }
     id, halfApplied := scanSpecialCall(fullId);
-    parts := fullId2parts(id, fullId);
-    typ   := setIdTypes(parts, fullId);
+    parts := fullId2parts(id, fullId, lx);
+    typ   := setIdTypes(parts, fullId, lx);
 
     if halfApplied && typ != common.TOK_FUNC_ID {
-      fullId.Error("Only functions can be half applied");
+      lx.errorAt(fullId, "Only functions can be half applied");
     }
     tok, moved = lx.newIdTok(typ, fullId, parts, halfApplied), true;
   }
   return;
 }
 
+// isStringPrefix - A letter directly in front of a string is the prefix of
+// its type (e.g. d"2011-03-21" or r`^[a-z]*$`).
+// The prefixes are checked by the parser.
+func isStringPrefix(id string, lx *Lexer) bool {
+  return len(id) == 1 && isAlpha(int(id[0])) &&
+         (lx.curChar == '"' || lx.curChar == '`');
+}
+
+// readTypedString - Read the string behind a prefix.
+// Strings of raw string types are read raw in double quotes, too (see
+// common.StringType).
+func readTypedString(prefix common.SrcPiece, lx *Lexer) common.Token {
+  letter := int(prefix.Content()[0]);
+  reader := readEscString;
+  if st := common.StringTypeOf(letter); lx.curChar == '`' ||
+                                          st != nil && st.Raw {
+    reader = readRawString;
+  }
+  str := readString(lx.curChar, lx, reader);
+  return lx.newTypedStringTok(prefix.Start(), letter, str);
+}
+
 func readFullId(lx *Lexer) common.SrcPiece {
   mark := lx.srcBuf.NewMark();
   for ; isIdChar(lx.curChar); lx.nextChar() { }
@@ -69,21 +128,22 @@ func scanSpecialCall(fullId common.SrcPiece) (id string, halfApplied bool) {
   return;
 }
 
-func fullId2parts(id string, fullId common.SrcPiece) []*IdPart {
+func fullId2parts(id string, fullId common.SrcPiece, lx *Lexer) []*IdPart {
   strParts := strings.Split(id, ".", 0);
   idParts := make([]*IdPart, len(strParts));
   for i, s := range strParts {
     if len(s) <= 0 {
-      fullId.Error("Illegal identifier");
+      lx.errorAt(fullId, "Illegal identifier");
+      return idParts[0:i];
     }
     idParts[i] = newIdPart(common.TOK_MODULE_ID, s, s[0] == '_');
   }
   return idParts;
 }
 
-func setIdTypes(parts []*IdPart, piece common.SrcPiece) common.TokEnum {
+func setIdTypes(parts []*IdPart, piece common.SrcPiece, lx *Lexer) common.TokEnum {
   for _, part := range parts {
-    part.typ = getIdType(part.id, piece);
+    part.typ = getIdType(part.id, piece, lx);
   }
 
   var tokTyp common.TokEnum = common.TOK_MODULE_ID;
@@ -93,42 +153,42 @@ func setIdTypes(parts []*IdPart, piece common.SrcPiece) common.TokEnum {
       if i <= 1 && tokTyp == common.TOK_MODULE_ID {
         tokTyp = common.TOK_CONST_ID;
       } else {
-        piece.Error("Illegal constant identifier part");
+        lx.errorAt(piece, "Illegal constant identifier part");
       }
     case tokTyp == common.TOK_CONST_ID:
       if part.typ != common.TOK_MODULE_ID && part.typ != common.TOK_VAL_ID {
-        piece.Error("Illegal constant identifier part");
+        lx.errorAt(piece, "Illegal constant identifier part");
       }
       part.typ = common.TOK_VAL_ID;
     case part.typ == common.TOK_MODULE_ID:
       if tokTyp == common.TOK_FUNC_ID {
-        piece.Error("Illegal value after function identifier part");
+        lx.errorAt(piece, "Illegal value after function identifier part");
       }
       if i >= 1 {
         part.typ = common.TOK_VAL_ID;
         tokTyp = common.TOK_VAL_ID;
       }
     case part.typ == common.TOK_FUNC_ID:
-      if i > 1 || tokTyp != common.TOK_MODULE_ID {
-        piece.Error("Illegal function identifier");
+      if tokTyp == common.TOK_FUNC_ID {   // values with sub IDs are fine
+        lx.errorAt(piece, "Illegal function identifier");
       }
       tokTyp = common.TOK_FUNC_ID;
     case part.typ == common.TOK_VAL_ID:
       if tokTyp == common.TOK_FUNC_ID {
-        piece.Error("Illegal value after function identifier part");
+        lx.errorAt(piece, "Illegal value after function identifier part");
       }
       if tokTyp == common.TOK_MODULE_ID {
         tokTyp = common.TOK_VAL_ID;
       }
     default:
-      piece.Error("Illegal identifier part");
+      lx.errorAt(piece, "Illegal identifier part");
     }
   }
 
   return tokTyp;
 }
 
-func getIdType(id string, piece common.SrcPiece) common.TokEnum {
+func getIdType(id string, piece common.SrcPiece, lx *Lexer) common.TokEnum {
   // ordinary flags:
   gotUpper := false;
   gotLower := false;
@@ -139,18 +199,22 @@ func getIdType(id string, piece common.SrcPiece) common.TokEnum {
   i := 0;
   firstUnder := (id[i] == '_');
   if firstUnder { i++; }
-  firstUpper := isUpper(id[i]);
-  firstLower := isLower(id[i]);
+  if i >= len(id) {
+    lx.errorAt(piece, "Illegal identifier part");
+    return common.TOK_VAL_ID;
+  }
+  firstUpper := isUpper(int(id[i]));
+  firstLower := isLower(int(id[i]));
   i++;
 
   if !firstUpper && !firstLower {
-    piece.Error("Illegal start of identifier part");
+    lx.errorAt(piece, "Illegal start of identifier part");
   }
 
   // set flags:
   lastUpper := firstUpper;
   for ; i < len(id); i++ {
-    b := id[i];    // SrcBuf guaranties 7 bit clean!
+    b := int(id[i]);    // readFullId guaranties 7 bit clean!
     switch {
     case isUpper(b):
       gotUpper = true;
@@ -166,7 +230,7 @@ func getIdType(id string, piece common.SrcPiece) common.TokEnum {
       gotUnder = true;
       lastUpper = false;
     default:
-      piece.Error("Illegal character in identifier part");
+      lx.errorAt(piece, "Illegal character in identifier part");
     }
   }
 
@@ -183,7 +247,7 @@ func getIdType(id string, piece common.SrcPiece) common.TokEnum {
     typ = common.TOK_FUNC_ID;
   default:
 //  fmt.Println("firstUpper:", firstUpper, ", gotLower:", gotLower, ", gotUnder:", gotUnder, ", got2Uppr:", got2Uppr);
-    piece.Error("Illegal identifier part");
+    lx.errorAt(piece, "Illegal identifier part");
   }
 
   return typ;
@@ -210,6 +274,8 @@ func tryOperator(lx *Lexer) (tok common.Token, moved bool) {
 func tryParen(lx *Lexer) (tok common.Token, moved bool) {
   if lx.curChar == '(' || lx.curChar == '[' || lx.curChar == '{' {
     tok, moved = getParenOpen(lx), true;
+  } else if lx.curChar == '}' && lx.inEmbedding() {
+    tok, moved = continueString(lx), true;
   } else if lx.curChar == ')' || lx.curChar == ']' || lx.curChar == '}' {
     tok, moved = getParenClose(lx), true;
   }
@@ -217,24 +283,35 @@ func tryParen(lx *Lexer) (tok common.Token, moved bool) {
 }
 
 func getParenOpen(lx *Lexer) common.Token {
-  if lx.inParens >= len(lx.parenStack) {
-    lx.Error("Too deeply nested parentheses");
-  }
   mark := lx.srcBuf.NewMark();
-  lx.parenStack[lx.inParens] = lx.curChar;
-  lx.inParens++;
+  pushParen(lx, byte(lx.curChar));
   lx.nextChar();
   return lx.newToken(common.TOK_PAREN_OPEN, mark);
 }
 
+func pushParen(lx *Lexer, paren byte) {
+  if lx.inParens >= len(lx.parenStack) {
+    lx.Error("Too deeply nested parentheses");
+  } else {
+    lx.parenStack[lx.inParens] = paren;
+    lx.inParens++;
+  }
+}
+
+// inEmbedding - Are we directly inside an expression embedded in a string?
+func (lx *Lexer) inEmbedding() bool {
+  return lx.inParens > 0 && lx.parenStack[lx.inParens-1] == EMBED_PAREN;
+}
+
 func getParenClose(lx *Lexer) common.Token {
+  mark := lx.srcBuf.NewMark();
   if lx.inParens <= 0 {
     lx.Error("Too many closing parentheses");
-  }
-  mark := lx.srcBuf.NewMark();
-  lx.inParens--;
-  if lx.parenStack[lx.inParens] != openParen(lx.curChar, lx) {
-    lx.Error("Parentheses don't fit together");
+  } else {
+    lx.inParens--;
+    if lx.parenStack[lx.inParens] != openParen(lx.curChar, lx) {
+      lx.Error("Parentheses don't fit together");
+    }
   }
   lx.nextChar();
   return lx.newToken(common.TOK_PAREN_CLOSE, mark);
@@ -243,31 +320,129 @@ func getParenClose(lx *Lexer) common.Token {
 func tryNumber(lx *Lexer) (tok common.Token, moved bool) {
   if isDigit(lx.curChar) {
     mark := lx.srcBuf.NewMark();
-    tok, moved = lx.newIntTok(mark, readInt(lx)), true;
+    base, digits := readDigits(lx);
+    if isFloatRest(lx, base) {
+      tok = lx.newFloatTok(mark, readFloat(lx, base, digits));
+    } else {
+      val := intValue(lx, base, digits);
+      tok = lx.newIntTok(mark, val, readIntSuffix(lx));
+    }
+    moved = true;
   }
   return;
 }
 
-func readInt(lx *Lexer) int64 {
-  base := 10;
-  strVal := "";
-
+// readDigits - Read the base and the digits of a number (without '_').
+func readDigits(lx *Lexer) (base int, digits string) {
+  base = 10;
   if lx.curChar == '0' {
     lx.nextChar();
     base = readBase(lx);
   }
   for ; isNumChar(lx.curChar, base); lx.nextChar() {
-    if (lx.curChar != '_') { strVal += string(lx.curChar); }
+    if (lx.curChar != '_') { digits += string(lx.curChar); }
   }
-  var ret int64 = 0;
-  if len(strVal) > 0 {
-    val, err := strconv.Btoi64(strVal, base);
-    if err != nil { lx.Error(err.String()) }
-    ret = val;
+  return;
+}
+
+// intValue - Convert the digits of an integer of any size.
+// Whether it fits into its data type is checked later by the checker.
+func intValue(lx *Lexer, base int, digits string) *big.Int {
+  ret := big.NewInt(0);
+  if len(digits) > 0 {
+    if _, ok := ret.SetString(digits, base); !ok {
+      lx.Error("Invalid integer constant");
+    }
   }
   return ret;
 }
 
+// readIntSuffix - Read the integer type directly behind the digits
+// (e.g. 255Int1).
+// This isn't possible for bases above 18 since 'I' is a digit there.
+// Anything else than the name of an integer type is left for the next
+// token (e.g. 3Foo is the number 3 and the ID Foo).
+func readIntSuffix(lx *Lexer) string {
+  suffix := "";
+  if isUpper(lx.curChar) {
+    for ; isAlpha(lx.curChar) || isDigit(lx.curChar); lx.nextChar() {
+      suffix += string(lx.curChar);
+    }
+  }
+  if suffix != "" && common.IntTypeNamed(suffix) == common.TYPE_UNKNOWN {
+    for i := 0; i < len(suffix); i++ { lx.prevChar(); }  // only ASCII
+    suffix = "";
+  }
+  return suffix;
+}
+
+// isFloatRest - Check whether a decimal or hexadecimal number continues
+// with a fraction or an exponent.
+// A '.' has to be followed by a digit since it could start a sub ID, too.
+func isFloatRest(lx *Lexer, base int) bool {
+  if base != 10 && base != 16 { return false; }
+  if lx.curChar != '.' { return isExponentChar(lx.curChar, base); }
+  lx.nextChar();
+  ret := isNumChar(lx.curChar, base) && lx.curChar != '_';
+  lx.prevChar();
+  return ret;
+}
+
+// isExponentChar - Decimal floats have a decimal exponent starting with 'e'
+// and hexadecimal floats have a binary exponent starting with 'p'
+// (since 'e' is a hexadecimal digit).
+func isExponentChar(ch int, base int) bool {
+  if base == 16 { return lower(ch) == 'p'; }
+  return lower(ch) == 'e';
+}
+
+// readFloat - Read the fraction and the exponent of a float.
+func readFloat(lx *Lexer, base int, digits string) float64 {
+  fraction := "";
+  if lx.curChar == '.' {
+    for lx.nextChar(); isNumChar(lx.curChar, base); lx.nextChar() {
+      if (lx.curChar != '_') { fraction += string(lx.curChar); }
+    }
+  }
+  exp := 0;
+  if isExponentChar(lx.curChar, base) {
+    lx.nextChar();
+    exp = readExponent(lx);
+  }
+  val, err := 0.0, os.Error(nil);
+  if base == 16 {
+    val = hexFloat(digits + fraction, exp - 4*len(fraction));
+  } else {
+    str := "0" + digits + "." + fraction + "e" + strconv.Itoa(exp);
+    val, err = strconv.Atof64(str);
+  }
+  if err != nil || math.IsInf(val, 0) { lx.Error("Float constant too big"); }
+  return val;
+}
+
+func readExponent(lx *Lexer) int {
+  sign := 1;
+  if lx.curChar == '+' || lx.curChar == '-' {
+    if lx.curChar == '-' { sign = -1; }
+    lx.nextChar();
+  }
+  if !isDigit(lx.curChar) { lx.Error("Missing digits of the exponent"); }
+  exp := 0;
+  for ; isNumChar(lx.curChar, 10); lx.nextChar() {
+    if (lx.curChar != '_') { exp = 10*exp + digitValue(lx.curChar); }
+  }
+  return sign * exp;
+}
+
+// hexFloat - Return the value of the hexadecimal digits times 2^exp.
+func hexFloat(digits string, exp int) float64 {
+  mantissa := 0.0;
+  for _, ch := range digits {
+    mantissa = 16*mantissa + float64(digitValue(ch));
+  }
+  return math.Ldexp(mantissa, exp);
+}
+
 func readBase(lx *Lexer) int {
   base := 10;
   switch lx.curChar {
@@ -310,22 +485,70 @@ func tryChar(lx *Lexer) (tok common.Token, moved bool) {
   return;
 }
 
-func readEscChar(lx *Lexer) byte {
+// readEscChar - Read a character that might be escaped.
+// Besides the single character escapes (see escaped2char) characters can be
+// given by their code: decimal with up to 3 digits (\0, \65, \255),
+// hexadecimal with exactly 2 digits (\xff) or as Unicode code point with
+// up to 6 hexadecimal digits in braces (\u{20ac}).
+func readEscChar(lx *Lexer) int {
   escaped := false;
   if lx.curChar == '\\' {
     escaped = true;
     lx.nextChar();
   }
-  char := escaped2char(escaped, lx.curChar, lx);
-  lx.nextChar();
+  char := 0;
+  switch {
+  case escaped && isDigit(lx.curChar):
+    char = readCharCode(lx, 10, 1, 3);
+  case escaped && lx.curChar == 'x':
+    lx.nextChar();
+    char = readCharCode(lx, 16, 2, 2);
+  case escaped && lx.curChar == 'u':
+    char = readUnicodeEscape(lx);
+  default:
+    char = escaped2char(escaped, lx.curChar, lx);
+    lx.nextChar();
+  }
   return char;
 }
 
-func escaped2char(escaped bool, char byte, lx *Lexer) byte {
+// readCharCode - Read the code of a character with at least min and at most
+// max digits in the base.
+func readCharCode(lx *Lexer, base int, min int, max int) int {
+  ret, n := 0, 0;
+  for val := digitValue(lx.curChar); n < max && val >= 0 && val < base;
+      val = digitValue(lx.curChar) {
+    ret = ret*base + val;
+    n++;
+    lx.nextChar();
+  }
+  if n < min { lx.Error("Too few digits in character code"); }
+  return ret;
+}
+
+func readUnicodeEscape(lx *Lexer) int {
+  lx.nextChar();  // skip the 'u'
+  if lx.curChar != '{' {
+    lx.Error("Expected '{' after \\u");
+    return 0;
+  }
+  lx.nextChar();
+  ret := readCharCode(lx, 16, 1, 6);
+  if lx.curChar != '}' {
+    lx.Error("Expected '}' after the code point");
+    return 0;
+  }
+  lx.nextChar();
+  if ret > 0x10ffff || ret >= 0xd800 && ret <= 0xdfff {
+    lx.Error("Invalid Unicode code point");
+  }
+  return ret;
+}
+
+func escaped2char(escaped bool, char int, lx *Lexer) int {
   ret := char;
-  if escaped && (isDigit(char) || isLower(char)) {
+  if escaped && isLower(char) {
     switch char {
-    case '0':  ret = 0;
     case 'a':  ret = '\a';
     case 'b':  ret = '\b';
     case 'd':  ret = 127;   // DEL
@@ -344,8 +567,11 @@ func escaped2char(escaped bool, char byte, lx *Lexer) byte {
 func tryString(lx *Lexer) (tok common.Token, moved bool) {
   if lx.curChar == '"' {
     mark := lx.srcBuf.NewMark();
-    str := readString(lx.curChar, lx, readEscString);
-    tok, moved = lx.newStringTok(mark, str), true;
+    inParens := lx.inParens;
+    str := readString(lx.curChar, lx, readEmbeddingString);
+    typ := common.TokEnum(common.TOK_STR);
+    if lx.inParens > inParens { typ = common.TOK_STR_START; }
+    tok, moved = lx.newStringPartTok(typ, mark, str), true;
   } else if lx.curChar == '`' {
     mark := lx.srcBuf.NewMark();
     str := readString(lx.curChar, lx, readRawString);
@@ -354,7 +580,7 @@ func tryString(lx *Lexer) (tok common.Token, moved bool) {
   return;
 }
 
-func readString(delim byte, lx *Lexer, readTypString func(*Lexer,byte,int)string) string {
+func readString(delim int, lx *Lexer, readTypString func(*Lexer,int,int)string) string {
   cnt := readCharCount(lx.curChar, lx, 9);
   ret := "";
   if cnt == 1 {
@@ -375,7 +601,7 @@ func readString(delim byte, lx *Lexer, readTypString func(*Lexer,byte,int)string
   return ret;
 }
 
-func readRawString(lx *Lexer, delim byte, max int) string {
+func readRawString(lx *Lexer, delim int, max int) string {
   ret := "";
   cnt := 0;
   for cnt < max && lx.curChar != common.EOF {
@@ -389,11 +615,27 @@ func readRawString(lx *Lexer, delim byte, max int) string {
   return ret;
 }
 
-func readEscString(lx *Lexer, delim byte, max int) string {
+func readEscString(lx *Lexer, delim int, max int) string {
+  return readEscParts(lx, delim, max, false);
+}
+
+// readEmbeddingString - Read an escaped string up to its end or up to the
+// opening brace of an embedded expression (e.g. "Hello {name}!").
+// A brace with a backslash in front of it is part of the string and so is
+// every brace behind an error (the rest of the token is skipped anyway).
+func readEmbeddingString(lx *Lexer, delim int, max int) string {
+  return readEscParts(lx, delim, max, true);
+}
+
+func readEscParts(lx *Lexer, delim int, max int, embed bool) string {
   ret := "";
   cnt := 0;
   for cnt < max && lx.curChar != common.EOF {
     for lx.curChar != delim && lx.curChar != common.EOF {
+      if embed && lx.curChar == '{' && !lx.failed {
+        openEmbedding(lx, max);
+        return ret;
+      }
       if max <= 1 && (lx.curChar == '\n' || lx.curChar == '\r') {
         lx.Error("Simple strings can't span multiple lines");
       }
@@ -405,7 +647,29 @@ func readEscString(lx *Lexer, delim byte, max int) string {
   return ret;
 }
 
-func readCharCount(char byte, lx *Lexer, max int) int {
+// openEmbedding - The opening brace of an embedded expression is handled
+// like an opening parenthesis. It remembers the number of delimiters of the
+// string, so the closing brace can continue the string.
+func openEmbedding(lx *Lexer, max int) {
+  if lx.inParens < len(lx.strDelims) { lx.strDelims[lx.inParens] = max; }
+  pushParen(lx, EMBED_PAREN);
+  lx.nextChar();
+}
+
+// continueString - Read the rest of a string behind an embedded expression
+// (up to the next embedded expression if any).
+func continueString(lx *Lexer) common.Token {
+  mark := lx.srcBuf.NewMark();
+  lx.inParens--;
+  inParens := lx.inParens;
+  lx.nextChar();  // skip the closing brace
+  str := readEmbeddingString(lx, '"', lx.strDelims[inParens]);
+  typ := common.TokEnum(common.TOK_STR_END);
+  if lx.inParens > inParens { typ = common.TOK_STR_MIDDLE; }
+  return lx.newStringPartTok(typ, mark, str);
+}
+
+func readCharCount(char int, lx *Lexer, max int) int {
   ret := 0;
   for lx.curChar == char && ret < max {
     ret++;
@@ -459,11 +723,38 @@ func tryComment(lx *Lexer) (tok common.Token, moved bool) {
   if lx.curChar == '#' {
     mark := lx.srcBuf.NewMark();
     for ; lx.curChar != '\n' && lx.curChar != '\r' && lx.curChar != common.EOF; lx.nextChar() { }
-    tok, moved = lx.newToken(common.TOK_COMMENT, mark), true;
+    comment := lx.newToken(common.TOK_COMMENT, mark);
+    if comment.StartLine() == lx.firstLine {
+      readPragma(lx, comment.SourcePiece());
+    }
+    tok, moved = comment, true;
   }
   return;
 }
 
+// readPragma - A comment in the first line can change settings of the lexer
+// for this source, e.g.: '# diamond: tabsize=8 strict-indent'
+func readPragma(lx *Lexer, comment common.SrcPiece) {
+  str := comment.Content();
+  if !strings.HasPrefix(str, PRAGMA_PREFIX) { return; }
+  for _, setting := range strings.Split(str[len(PRAGMA_PREFIX):len(str)], " ", 0) {
+    switch {
+    case setting == "":
+    case setting == "strict-indent":
+      lx.strict = true;
+    case strings.HasPrefix(setting, "tabsize="):
+      size, err := strconv.Atoi(setting[len("tabsize="):len(setting)]);
+      if err != nil || size <= 0 {
+        comment.Error("Invalid tab size in pragma: " + setting);
+      } else {
+        lx.tabSize = size;
+      }
+    default:
+      comment.Error("Unknown pragma setting: " + setting);
+    }
+  }
+}
+
 func tryEof(lx *Lexer) (tok common.Token, moved bool) {
   if lx.curChar == common.EOF {
     tok, moved = lx.newEofTok(), true;
@@ -474,6 +765,7 @@ func tryEof(lx *Lexer) (tok common.Token, moved bool) {
 
 func signalUndefined(lx *Lexer) (tok common.Token, moved bool) {
   lx.Error("Unknown token");
-  return nil, false;
+  lx.nextChar();
+  return nil, true;
 }
 
@@ -1,6 +1,7 @@
 package lexer
 
 import (
+  "diamondlang/common";
   "strings";
 )
 
@@ -10,8 +11,20 @@ import (
 // --------------------------------------------------------------------------
 
 const MAX_PARENS = 8
+const EMBED_PAREN = '"'   // on the paren stack for embedded expressions
 const OPERATOR_CHARS = "+-*/%^<>!=&|?$~"
 const NUM_CHARS = "_0123456789abcdefghijklmnopqrstuvwxyz"
+const PRAGMA_PREFIX = "# diamond:"
+
+// identifiers that are really keywords
+var keywords = map[string]common.TokEnum {
+  "def":      common.TOK_DEF,
+  "extern":   common.TOK_EXTERN,
+  "import":   common.TOK_IMPORT,
+  "shelf":    common.TOK_SHELF,
+  "bind":     common.TOK_BIND,
+  "shadowed": common.TOK_SHADOWED,
+}
 
 
 // --------------------------------------------------------------------------
@@ -19,35 +32,40 @@ const NUM_CHARS = "_0123456789abcdefghijklmnopqrstuvwxyz"
 // --------------------------------------------------------------------------
 
 // look for char in string
-func IsIn(ch byte, str string) bool {
+func IsIn(ch int, str string) bool {
   return strings.Index(str, string(ch)) >= 0;
 }
 
-func isOpChar(ch byte) bool { return IsIn(ch, OPERATOR_CHARS) }
-func isDigit(ch byte) bool { return (ch >= '0' && ch <= '9') }
-func isUpper(ch byte) bool { return (ch >= 'A' && ch <= 'Z') }
-func isLower(ch byte) bool { return (ch >= 'a' && ch <= 'z') }
-func isAlpha(ch byte) bool { return isLower(ch) || isUpper(ch) }
-func isConstChar(ch byte) bool { return (isUpper(ch) || ch == '_' || isDigit(ch)) }
+func isOpChar(ch int) bool { return IsIn(ch, OPERATOR_CHARS) }
+func isDigit(ch int) bool { return (ch >= '0' && ch <= '9') }
+func isUpper(ch int) bool { return (ch >= 'A' && ch <= 'Z') }
+func isLower(ch int) bool { return (ch >= 'a' && ch <= 'z') }
+func isAlpha(ch int) bool { return isLower(ch) || isUpper(ch) }
+func isConstChar(ch int) bool { return (isUpper(ch) || ch == '_' || isDigit(ch)) }
 
-func isNumChar(ch byte, base int) bool {
+func isNumChar(ch int, base int) bool {
   idx := strings.Index(NUM_CHARS, string(lower(ch)));
   return idx >= 0 && idx <= base;
 }
 
 
-func lower(ch byte) byte {
+// digitValue - Return the value of a digit in any base.
+func digitValue(ch int) int {
+  return strings.Index(NUM_CHARS, string(lower(ch))) - 1;
+}
+
+func lower(ch int) int {
   if ch >= 'A' && ch <= 'Z' {
     return 'a' + (ch - 'A');
   }
   return ch;
 }
 
-func isIdChar(ch byte) bool {
+func isIdChar(ch int) bool {
   return (isAlpha(ch) || isDigit(ch) || ch == '_' || ch == '.' || ch == '\\');
 }
 
-func isIdStartChar(ch byte) bool {
+func isIdStartChar(ch int) bool {
   return (isAlpha(ch) || ch == '_' || ch == '.' || ch == '\\');
 }
 
@@ -2,6 +2,7 @@ package lexer
 
 import (
   "diamondlang/common";
+  "big";
 )
 
 
@@ -17,7 +18,7 @@ type SimpleToken struct {
 
 func Token2simple(tok common.Token) *SimpleToken {
   st, ok := tok.(*SimpleToken);
-  if !ok { tok.Error("Not a simple token"); }
+  if !ok { panic("Not a simple token"); }
   return st;
 }
 
@@ -47,13 +48,13 @@ func (tok *SimpleToken) HasSpaceAround() int {
   line  := tok.WholeLine();
   // look for space before token:
   front := 0;
-  col   := tok.StartColumn() - 1;
-  if col < 0 || common.IsSpace(line[col]) { front = 1 }
+  col   := tok.SourcePiece().Start().Col - 1;
+  if col < 0 || common.IsSpace(int(line[col])) { front = 1 }
 
   // look for space after token:
   back := 0;
-  col   = tok.StartColumn() + len(tok.Content());
-  if col >= len(line) || common.IsSpace(line[col]) { back = 1 }
+  col   = tok.SourcePiece().Start().Col + len(tok.Content());
+  if col >= len(line) || common.IsSpace(int(line[col])) { back = 1 }
 
   return back - front;
 }
@@ -65,7 +66,7 @@ type EofTok struct {
 }
 func Token2eof(tok common.Token) *EofTok {
   et, ok := tok.(*EofTok);
-  if !ok { tok.Error("Not an EOF token"); }
+  if !ok { panic("Not an EOF token"); }
   return et;
 }
 func (lx *Lexer) newEofTok() *EofTok {
@@ -73,37 +74,57 @@ func (lx *Lexer) newEofTok() *EofTok {
 }
 func (tok *EofTok) String() string { return "<EOF>" }
 
-/// IntTok - Signal an integer constant.
+/// IntTok - Signal an integer constant of any size.
+/// The suffix is the name of its integer type (e.g. Int2) or empty.
 type IntTok struct {
   *SimpleToken;
-  value int64;
+  value  *big.Int;
+  suffix string;
 }
 func Token2int(tok common.Token) *IntTok {
   it, ok := tok.(*IntTok);
-  if !ok { tok.Error("Not an integer token"); }
+  if !ok { panic("Not an integer token"); }
   return it;
 }
-func (lx *Lexer) newIntTok(mark common.SrcMark, val int64) *IntTok {
+func (lx *Lexer) newIntTok(mark common.SrcMark, val *big.Int,
+                           suffix string) *IntTok {
   tok := lx.newToken(common.TOK_INT, mark);
-  return &IntTok{tok, val};
+  return &IntTok{tok, val, suffix};
 }
-func (tok *IntTok) Value() int64 { return tok.value }
+func (tok *IntTok) Value() *big.Int { return tok.value }
+func (tok *IntTok) Suffix() string { return tok.suffix }
 
-/// CharTok - Signal a character constant.
+/// FloatTok - Signal a floating point constant.
+type FloatTok struct {
+  *SimpleToken;
+  value float64;
+}
+func Token2float(tok common.Token) *FloatTok {
+  ft, ok := tok.(*FloatTok);
+  if !ok { panic("Not a float token"); }
+  return ft;
+}
+func (lx *Lexer) newFloatTok(mark common.SrcMark, val float64) *FloatTok {
+  tok := lx.newToken(common.TOK_FLOAT, mark);
+  return &FloatTok{tok, val};
+}
+func (tok *FloatTok) Value() float64 { return tok.value }
+
+/// CharTok - Signal a character constant (its value is a Unicode code point).
 type CharTok struct {
   *SimpleToken;
-  value byte;
+  value int;
 }
 func Token2char(tok common.Token) *CharTok {
   ct, ok := tok.(*CharTok);
-  if !ok { tok.Error("Not a character token"); }
+  if !ok { panic("Not a character token"); }
   return ct;
 }
-func (lx *Lexer) newCharTok(mark common.SrcMark, val byte) *CharTok {
+func (lx *Lexer) newCharTok(mark common.SrcMark, val int) *CharTok {
   tok := lx.newToken(common.TOK_CHAR, mark);
   return &CharTok{tok, val};
 }
-func (tok *CharTok) Value() byte { return tok.value }
+func (tok *CharTok) Value() int { return tok.value }
 
 /// StringTok - Signal a string constant.
 type StringTok struct {
@@ -112,15 +133,39 @@ type StringTok struct {
 }
 func Token2string(tok common.Token) *StringTok {
   st, ok := tok.(*StringTok);
-  if !ok { tok.Error("Not a string token"); }
+  if !ok { panic("Not a string token"); }
   return st;
 }
 func (lx *Lexer) newStringTok(mark common.SrcMark, val string) *StringTok {
-  tok := &SimpleToken{common.TOK_STR, lx.srcBuf.NewPiece(mark)};
+  return lx.newStringPartTok(common.TOK_STR, mark, val);
+}
+// newStringPartTok - Strings with embedded expressions consist of several
+// string tokens (see TOK_STR_START, TOK_STR_MIDDLE and TOK_STR_END).
+func (lx *Lexer) newStringPartTok(typ common.TokEnum, mark common.SrcMark,
+                                  val string) *StringTok {
+  tok := &SimpleToken{typ, lx.srcBuf.NewPiece(mark)};
   return &StringTok{tok, val};
 }
 func (tok *StringTok) Value() string { return tok.value }
 
+/// TypedStringTok - Signal a string constant with a type prefix
+/// (e.g. d"2011-03-21").
+type TypedStringTok struct {
+  *StringTok;
+  prefix int;
+}
+func Token2typedString(tok common.Token) *TypedStringTok {
+  st, ok := tok.(*TypedStringTok);
+  if !ok { panic("Not a typed string token"); }
+  return st;
+}
+func (lx *Lexer) newTypedStringTok(mark common.SrcMark, prefix int,
+                                   val string) *TypedStringTok {
+  tok := &SimpleToken{common.TOK_TYPED_STR, lx.srcBuf.NewPiece(mark)};
+  return &TypedStringTok{&StringTok{tok, val}, prefix};
+}
+func (tok *TypedStringTok) Prefix() int { return tok.prefix }
+
 /// SpaceTok - Signal some space.
 type SpaceTok struct {
   *SimpleToken;
@@ -129,7 +174,7 @@ type SpaceTok struct {
 }
 func Token2space(tok common.Token) *SpaceTok {
   st, ok := tok.(*SpaceTok);
-  if !ok { tok.Error("Not a space token"); }
+  if !ok { panic("Not a space token"); }
   return st;
 }
 func (lx *Lexer) newSpaceTok(mark common.SrcMark, space int, atStartOfLine bool) *SpaceTok {
@@ -164,12 +209,12 @@ type IdTok struct {
 }
 func Token2id(tok common.Token) *IdTok {
   it, ok := tok.(*IdTok);
-  if !ok { tok.Error("Not an ID token"); }
+  if !ok { panic("Not an ID token"); }
   return it;
 }
 func (lx *Lexer) newIdTok(typ common.TokEnum, piece common.SrcPiece,
                           parts []*IdPart, halfApplied bool) *IdTok {
-  if len(parts) <= 0 { piece.Error("ID has no parts"); }
+  if len(parts) <= 0 { lx.errorAt(piece, "ID has no parts"); }
   return &IdTok{&SimpleToken{typ, piece}, parts, halfApplied};
 }
 func (tok *IdTok) Parts() []*IdPart { return tok.parts }
@@ -182,7 +227,7 @@ type OperatorTok struct {
 }
 func Token2operator(tok common.Token) *OperatorTok {
   ot, ok := tok.(*OperatorTok);
-  if !ok { tok.Error("Not an operator token"); }
+  if !ok { panic("Not an operator token"); }
   return ot;
 }
 func (lx *Lexer) newOperatorTok(mark common.SrcMark, halfApplied bool) *OperatorTok {
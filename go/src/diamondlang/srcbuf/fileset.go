@@ -0,0 +1,82 @@
+package srcbuf
+
+import (
+  "diamondlang/common";
+  "container/list";
+  "io";
+  "os";
+)
+
+
+// --------------------------------------------------------------------------
+// A file set holds all sources of a compilation (e.g. of a module that
+// consists of several files).
+// Every source in a file set gets a unique ID starting at 1.
+// Sources that don't belong to any file set have the ID 0.
+// The IDs are only unique inside of a file set: The pieces of one
+// compilation are never compared with the pieces of another one, and
+// counting per set keeps the IDs (and so the diagnostics) of a compilation
+// independent of the other compilations in the same process.
+// --------------------------------------------------------------------------
+type FileSet struct {
+  sources *list.List;            // all sources in the order they were added
+  sink     common.DiagnosticSink; // for all sources of the set (or nil)
+}
+
+func NewFileSet() *FileSet {
+  return &FileSet{list.New(), nil};
+}
+
+// AddFile - Open the file and add it as the next source of the set.
+// The error of opening the file is returned and nothing is added then.
+func (fs *FileSet) AddFile(filename string) (*SrcBuffer, os.Error) {
+  sb, err := NewSourceFromFile(filename);
+  if err != nil { return nil, err; }
+  return fs.add(sb), nil;
+}
+
+// AddBuffer - Add the buffer as the next source of the set.
+func (fs *FileSet) AddBuffer(buf []byte, name string) *SrcBuffer {
+  return fs.add(NewSourceFromBuffer(buf, name));
+}
+
+// AddReader - Add the reader as the next source of the set.
+func (fs *FileSet) AddReader(rd io.Reader, name string) *SrcBuffer {
+  return fs.add(NewSourceFromReader(rd, name));
+}
+
+func (fs *FileSet) add(sb *SrcBuffer) *SrcBuffer {
+  fs.sources.PushBack(sb);
+  sb.id = fs.sources.Len();
+  if fs.sink != nil { sb.SetDiagnosticSink(fs.sink); }
+  return sb;
+}
+
+// SetDiagnosticSink - All errors about the sources of the set (even the ones
+// that are added later) are reported to the sink.
+func (fs *FileSet) SetDiagnosticSink(sink common.DiagnosticSink) {
+  fs.sink = sink;
+  for e := fs.sources.Front(); e != nil; e = e.Next() {
+    e.Value.(*SrcBuffer).SetDiagnosticSink(sink);
+  }
+}
+
+func (fs *FileSet) Len() int { return fs.sources.Len(); }
+
+// Source - Return the source with the given ID or nil if there is none.
+func (fs *FileSet) Source(id int) *SrcBuffer {
+  for e := fs.sources.Front(); e != nil; e = e.Next() {
+    if sb := e.Value.(*SrcBuffer); sb.id == id { return sb; }
+  }
+  return nil;
+}
+
+func (fs *FileSet) Sources() []*SrcBuffer {
+  ret := make([]*SrcBuffer, fs.sources.Len());
+  i := 0;
+  for e := fs.sources.Front(); e != nil; e = e.Next() {
+    ret[i] = e.Value.(*SrcBuffer);
+    i++;
+  }
+  return ret;
+}
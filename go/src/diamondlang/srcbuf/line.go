@@ -2,10 +2,14 @@ package srcbuf
 
 import (
   "diamondlang/common";
-  "fmt";
+  "bytes";
   "os";
+  "utf8";
 )
 
+// marks the end of the source in a line (0xff is never part of valid UTF-8)
+const eofByte = 0xff
+
 type line struct {
   num   int;
   buf   []byte;
@@ -14,7 +18,7 @@ type line struct {
 func any2line(any interface{}) *line {
   line, ok := any.(*line);
   if !ok {
-    common.HandleFatal("Internal error (not a line)!");
+    panic("Internal error (not a line)!");
   }
   return line;
 }
@@ -22,7 +26,7 @@ func any2line(any interface{}) *line {
 // String -- returns the content of the line as a string without line ending.
 func (l *line) String() string {
   n := len(l.buf) - 1;
-  if n >= 0 && l.buf[n] == common.EOF {
+  if n >= 0 && l.buf[n] == eofByte {
     n--;
   } else {
     for n >= 0 && (l.buf[n] == '\n' || l.buf[n] == '\r') {
@@ -37,40 +41,59 @@ func (l *line) String() string {
 
 // read a line from the readByter (only "\n" and "\r\n" are recognized as line endings)
 func newLine(rb readByter, num int) (l *line, err os.Error) {
-  buf := new([256]byte);
-  pos := 0;
+  buf := new(bytes.Buffer);  // grows as needed, so lines can have any length
 
   // read almost a full line into the buffer
   c,e := rb.ReadByte();
   for ; e == nil && c != '\n';
       c,e = rb.ReadByte() {
-    if !legalChar(c) {
-      common.HandleFatal(fmt.Sprintf("Unable to handle non-ASCII character %d in line %d!", c, num));
-    }
-    putChar(c, buf, pos, num);
-    pos++;
+    buf.WriteByte(c);
   }
 
   // handle last character
   if e == os.EOF {
-    putChar(common.EOF, buf, pos, num);
+    buf.WriteByte(eofByte);
   } else if e != nil {
     return nil, e;
   } else {
-    putChar(c, buf, pos, num);
+    buf.WriteByte(c);
+  }
+
+  return &line{num, buf.Bytes()}, nil;
+}
+
+// invalidCol -- returns the byte position of the first byte that isn't valid
+// UTF-8 or -1 if the whole line is valid.
+func (l *line) invalidCol() int {
+  for i := 0; i < len(l.buf); {
+    rune, size := l.runeAt(i);
+    if rune == utf8.RuneError && size <= 1 { return i; }
+    i += size;
   }
+  return -1;
+}
 
-  return &line{num, buf[0:pos+1]}, nil;
+// runeAt -- returns the rune starting at byte position col and its size in bytes.
+func (l *line) runeAt(col int) (rune int, size int) {
+  if col == len(l.buf)-1 && l.buf[col] == eofByte {
+    return common.EOF, 1;
+  }
+  return utf8.DecodeRune(l.buf[col:len(l.buf)]);
 }
 
-func putChar(c byte, buf []byte, pos int, num int) {
-  if pos >= len(buf) {
-    common.HandleFatal(fmt.Sprintf("Line %d is longer than %d bytes!", num, len(buf)));
+// prevCol -- returns the byte position of the rune before byte position col.
+func (l *line) prevCol(col int) int {
+  col--;
+  for col > 0 && l.buf[col] & 0xc0 == 0x80 {
+    col--;
   }
-  buf[pos] = c;
+  return col;
 }
 
-func legalChar(c byte) bool {
-  return c >= 0 && c < 128;
+// column -- converts the byte position col into a column counted in runes.
+func (l *line) column(col int) int {
+  if col <= 0 { return col; }
+  if col > len(l.buf) { col = len(l.buf); }
+  return utf8.RuneCount(l.buf[0:col]);
 }
 
@@ -10,10 +10,6 @@ import (
   "fmt";
 )
 
-const (
-  MAX_BUFFER_LINES = 1024;
-)
-
 type readByter interface {
   ReadByte() (c byte, err os.Error);
 }
@@ -23,13 +19,17 @@ type readByter interface {
 // The state of a source reading buffer is held in a variable of this type:
 // --------------------------------------------------------------------------
 type SrcBuffer struct {
+  name         string;       // name of the source (file name) for diagnostics
+  id           int;          // unique ID in a file set (0 without file set)
+  firstLine    int;          // number of the first line (normally 0)
   source       readByter;    // our source for bytes
   buf         *list.List;    // the real buffer of lines
   curElem     *list.Element; // the current element in the buffer
   curLine     *line;         // the current line in the buffer
-  curCol       int;          // current column in the current line
+  curCol       int;          // byte position of the current rune in the line
   atLineStart  bool;         // are we *really* at the start of the line?
   eof          bool;
+  sink         common.DiagnosticSink; // gets all errors about this source
 }
 
 
@@ -37,28 +37,50 @@ type SrcBuffer struct {
 func NewSourceFromFile(filename string) (srcBuf *SrcBuffer, err os.Error) {
   file, e := os.Open(filename, os.O_RDONLY, 0444);
   if e != nil { return nil, e }
-  return NewSourceFromReader(file), nil;
+  return NewSourceFromReader(file, filename), nil;
 }
 
-func NewSourceFromBuffer(buf []byte) *SrcBuffer {
-  return NewSourceFromReader(bytes.NewBuffer(buf));
+func NewSourceFromBuffer(buf []byte, name string) *SrcBuffer {
+  return NewSourceFromReader(bytes.NewBuffer(buf), name);
 }
 
-func NewSourceFromReader(rd io.Reader) *SrcBuffer {
+// The name is used in diagnostics and should be the name of the file
+// if there is one.
+func NewSourceFromReader(rd io.Reader, name string) *SrcBuffer {
   src, ok := rd.(readByter);
   if !ok {
     src = bufio.NewReader(rd);
   }
-  ret := &SrcBuffer{src, list.New(), nil, nil, -1, true, false};
+  ret := &SrcBuffer{name, 0, 0, src, list.New(), nil, nil, -1, true, false,
+                    common.NewDiagnosticPrinter(os.Stderr)};
   return ret;
 }
 
+// Name - Return the name of the source (normally the file name).
+func (sb *SrcBuffer) Name() string { return sb.name; }
+
+// ID - Return the ID of the source in its file set (see FileSet).
+func (sb *SrcBuffer) ID() int { return sb.id; }
 
-// Error - Handle errors by writing a description to STDERR and exiting.
+// SetFirstLine - The source is a part of a bigger one that starts at the
+// given line number. It has to be called before the first character is read.
+func (sb *SrcBuffer) SetFirstLine(num int) {
+  sb.firstLine = num;
+}
+
+// SetDiagnosticSink - All errors about this source are reported to the sink.
+// By default they are written to STDERR.
+func (sb *SrcBuffer) SetDiagnosticSink(sink common.DiagnosticSink) {
+  sb.sink = sink;
+}
+
+
+// Error - Report an error about the current character.
 func (sb *SrcBuffer) Error(msg string) {
-  common.HandleFatal(
-      common.MakeErrString(msg, sb.curLine.num, sb.curLine.String(), sb.curCol, 1)
-  );
+  start := sb.curCol;
+  if start < 0 { start = 0; }
+  end := common.SrcMark{sb.curElem, sb.nextCol()};
+  sb.NewAnyPiece(common.SrcMark{sb.curElem, start}, end).Error(msg);
 }
 
 func (sb *SrcBuffer) AtStartOfLine() bool {
@@ -70,9 +92,9 @@ func (sb *SrcBuffer) NotAtStartOfLine() {
 }
 
 // remove old lines from the buffer
-// Caution: This is the only way to remove line and to prevent a buffer overflow!
-//          If lines would be removed automatically from the buffer it would break
-//          tokens spanning multiple lines!
+// The buffer can hold any number of lines, so this is only needed to save memory.
+// Caution: Lines aren't removed automatically from the buffer because that would
+//          break tokens spanning multiple lines!
 func (sb *SrcBuffer) ClearUpTo(mark common.SrcMark) {
   elem := mark.Elem;
   for elem.Prev() != nil {
@@ -83,13 +105,14 @@ func (sb *SrcBuffer) ClearUpTo(mark common.SrcMark) {
 // unget a character from the source code
 func (sb *SrcBuffer) Ungetch() {
     if sb.curCol < 0 {
-      sb.Error("Unable to unget characters beyond the beginning of the current line");
+      panic("Unable to unget characters beyond the beginning of the current line");
     }
-    sb.curCol--;
+    sb.curCol = sb.curLine.prevCol(sb.curCol);
+    sb.eof = false;
 }
 
-// get the next character from the source code
-func (sb *SrcBuffer) Getch() byte {
+// get the next character (rune) from the source code
+func (sb *SrcBuffer) Getch() int {
   // handle EOF
   if sb.eof { return common.EOF; }
 
@@ -99,14 +122,19 @@ func (sb *SrcBuffer) Getch() byte {
   }
 
   // read new character
-  sb.curCol++;
-  ch := sb.curLine.buf[sb.curCol];
+  sb.curCol = sb.nextCol();
+  ch, _ := sb.curLine.runeAt(sb.curCol);
   if ch == common.EOF { sb.eof = true; }  // handle EOF
 
   return ch;
 }
+func (sb *SrcBuffer) nextCol() int {
+  if sb.curCol < 0 { return 0; }
+  _, size := sb.curLine.runeAt(sb.curCol);
+  return sb.curCol + size;
+}
 func (sb *SrcBuffer) mustGotoNextLine() bool {
-  return sb.curLine == nil || sb.curCol+1 >= len(sb.curLine.buf);
+  return sb.curLine == nil || sb.nextCol() >= len(sb.curLine.buf);
 }
 func (sb *SrcBuffer) gotoNextLine() {
   if sb.curElem == nil || sb.curElem.Next() == nil {
@@ -121,20 +149,24 @@ func (sb *SrcBuffer) gotoNextLine() {
 
 // read a new line and append it to the source buffer
 func (sb *SrcBuffer) readNewLine() {
-  if sb.buf.Len() > MAX_BUFFER_LINES {
-    sb.Error("Buffer overflow; please break up your code into smaller pieces");
-  }
-
-  num := 0;
+  num := sb.firstLine;
   if sb.curLine != nil {
     num = sb.curLine.num + 1;
   }
-  line, err := newLine(sb.source, num);
+  l, err := newLine(sb.source, num);
   if err != nil {
-    common.HandleFatal(fmt.Sprintf("While reading line %d: %v", num+1, err.String()));
+    // report the error and handle it like the end of the source
+    sb.sink.Report(common.NewDiagnostic(common.SEV_ERROR,
+        fmt.Sprintf("While reading line %d: %v", num+1, err.String()), nil));
+    l = &line{num, []byte{eofByte}};
+  }
+  sb.curLine = l;
+  sb.curElem = sb.buf.PushBack(l);
+  if col := l.invalidCol(); col >= 0 {
+    start := common.SrcMark{sb.curElem, col};
+    sb.NewAnyPiece(start, common.SrcMark{sb.curElem, col+1}).Error(
+        "Invalid UTF-8 encoding");
   }
-  sb.curLine = line;
-  sb.curElem = sb.buf.PushBack(line);
 }
 
 
@@ -147,6 +179,7 @@ func (sb *SrcBuffer) NewMark() common.SrcMark {
 }
 
 type SrcPiece struct {
+  sb    *SrcBuffer;  // the source this piece belongs to
   start common.SrcMark;
   end   common.SrcMark;
 }
@@ -155,23 +188,62 @@ type SrcPiece struct {
 // The given mark is the start of the piece.
 // The piece ends one character before the current reading position.
 func (sb *SrcBuffer) NewPiece(start common.SrcMark) common.SrcPiece {
-  return &SrcPiece{start, sb.NewMark()};
+  return &SrcPiece{sb, start, sb.NewMark()};
 }
 
 func (sb *SrcBuffer) NewAnyPiece(start common.SrcMark, end common.SrcMark) common.SrcPiece {
-  return &SrcPiece{start, end};
+  return &SrcPiece{sb, start, end};
 }
 
 func (piece *SrcPiece) Start() common.SrcMark { return piece.start; }
 func (piece *SrcPiece) End() common.SrcMark { return piece.end; }
 func (piece *SrcPiece) StartLine() int { return any2line(piece.start.Elem.Value).num; }
-func (piece *SrcPiece) StartColumn() int { return piece.start.Col; }
+func (piece *SrcPiece) StartColumn() int {
+  return any2line(piece.start.Elem.Value).column(piece.start.Col);
+}
+// EndLine and EndColumn tell the position of the character after the piece.
+func (piece *SrcPiece) EndLine() int { return any2line(piece.end.Elem.Value).num; }
+func (piece *SrcPiece) EndColumn() int {
+  col := any2line(piece.end.Elem.Value).column(piece.end.Col);
+  if col < 0 { col = 0; }
+  return col;
+}
+func (piece *SrcPiece) FileName() string { return piece.sb.name; }
+func (piece *SrcPiece) FileID() int { return piece.sb.id; }
 func (piece *SrcPiece) String() string { return piece.Content() }
 
+// Error - Report an error about this piece to the sink of its source.
 func (piece *SrcPiece) Error(msg string) {
-  common.HandleFatal(common.MakeErrString(msg, piece.StartLine(), piece.WholeLine(),
-      piece.StartColumn(), len(piece.Content()) )
-  );
+  piece.Report(common.NewDiagnostic(common.SEV_ERROR, msg, piece));
+}
+
+// Report - Report any diagnostic (e.g. with notes) to the sink of the source.
+func (piece *SrcPiece) Report(diag *common.Diagnostic) {
+  piece.sb.sink.Report(diag);
+}
+
+// MoveLines - Add delta to the numbers of all lines the pieces start or end
+// in (every line only once).
+// This is needed after lines have been inserted or removed in front of the
+// pieces (see tokbuf.Relex).
+func MoveLines(pieces []common.SrcPiece, delta int) {
+  moved := make(map[*line]bool);
+  for _, p := range pieces {
+    piece := p.(*SrcPiece);
+    for _, elem := range []*list.Element{piece.start.Elem, piece.end.Elem} {
+      l := any2line(elem.Value);
+      if _, done := moved[l]; !done {
+        l.num += delta;
+        moved[l] = true;
+      }
+    }
+  }
+}
+
+// Until - Return the piece from the start of this piece to the end of the
+// given one (of the same source).
+func (piece *SrcPiece) Until(end common.SrcPiece) common.SrcPiece {
+  return &SrcPiece{piece.sb, piece.start, end.End()};
 }
 
 func (piece *SrcPiece) WholeLine() string {
@@ -3,16 +3,17 @@ package srcbuf
 import (
   "testing";
   "diamondlang/common";
+  "strings";
 )
 
 
 func TestAscii(t *testing.T) {
   var ascii [128]byte;
   for i := 0; i < len(ascii); i++ { ascii[i] = byte(i); }
-  sb := NewSourceFromBuffer(&ascii);
+  sb := NewSourceFromBuffer(&ascii, "test");
   for i := 0; i < len(ascii); i++ {
     ch := sb.Getch();
-    if ch != byte(i) {
+    if ch != i {
       t.Fatalf("ASCII character not recognized (act %d != %d exp).", ch, i);
     }
   }
@@ -21,9 +22,54 @@ func TestAscii(t *testing.T) {
   }
 }
 
+func TestUtf8(t *testing.T) {
+  tstBuf := strings.Bytes("# Grüße\n\"Straße\" x");
+  sb := NewSourceFromBuffer(tstBuf, "test");
+  for _, rune := range "# Grüße\n\"Stra" {
+    if ch := sb.Getch(); ch != rune {
+      t.Fatalf("Rune not recognized (act %d != %d exp).", ch, rune);
+    }
+  }
+  sb.Getch();  // got 'ß'
+  mark := sb.NewMark();
+  sb.Getch();  // got 'e'
+  testSrcPiece(sb.NewPiece(mark), 1, 5, "ß", "\"Straße\" x", t, 1);
+  sb.Ungetch();
+  sb.Ungetch();
+  if ch := sb.Getch(); ch != 'ß' {
+    t.Errorf("Ungetch() didn't move back by one rune (got %d).", ch);
+  }
+  sb.Getch();  // got 'e'
+  sb.Getch();  // got '"'
+  sb.Getch();  // got ' '
+  mark = sb.NewMark();
+  sb.Getch();  // got 'x'
+  testSrcPiece(sb.NewPiece(mark), 1, 8, " ", "\"Straße\" x", t, 2);
+  if sb.Getch() != common.EOF {
+    t.Error("EOF not recognized.");
+  }
+}
+
+func TestLongSource(t *testing.T) {
+  longLine := strings.Repeat("x", 1000);
+  src := strings.Repeat(longLine + "\n", 2000);
+  sb := NewSourceFromBuffer(strings.Bytes(src), "test");
+  for i := 0; i < len(src); i++ {
+    if ch := sb.Getch(); ch != int(src[i]) {
+      t.Fatalf("Character %d not recognized (act %d != %d exp).", i, ch, src[i]);
+    }
+  }
+  if sb.curLine.num != 1999 || sb.curLine.String() != longLine {
+    t.Errorf("Last line not read completely (line %d).", sb.curLine.num);
+  }
+  if sb.Getch() != common.EOF {
+    t.Error("EOF not recognized.");
+  }
+}
+
 func TestAtStartOfLine(t *testing.T) {
   tstBuf := []byte{ 'a', '\n', 'b', '\n', 'c' };
-  sb := NewSourceFromBuffer(tstBuf);
+  sb := NewSourceFromBuffer(tstBuf, "test");
   if !sb.AtStartOfLine() {
     t.Error("Start of buffer isn't start of line.");
   }
@@ -55,7 +101,7 @@ func TestAtStartOfLine(t *testing.T) {
 
 func TestLineEndings(t *testing.T) {
   tstBuf := []byte{ 'a', '\n', 'b', '\r', '\n', '\r', '\n', 'c' };
-  sb := NewSourceFromBuffer(tstBuf);
+  sb := NewSourceFromBuffer(tstBuf, "test");
   sb.Getch();  // got 'a'
   if sb.curLine == nil {
     t.Fatal("1. line not read.");
@@ -115,7 +161,7 @@ func TestLineEndings(t *testing.T) {
 
 func TestSrcMark(t *testing.T) {
   tstBuf := []byte{ 'a', '\n', 'b', '\r', '\n', '\r', '\n', 'e' };
-  sb := NewSourceFromBuffer(tstBuf);
+  sb := NewSourceFromBuffer(tstBuf, "test");
   sb.Getch();  // got 'a'
   mark1 := sb.NewMark();
   testSrcPiece(sb.NewPiece(mark1), 0, 0, "", "a", t, 11);
@@ -158,6 +204,71 @@ func TestSrcMark(t *testing.T) {
   testSrcPiece(sb.NewPiece(mark3), 1, 0, "b\r\n\r\ne", "b\n\ne", t, 103);
 }
 
+func TestDiagnosticFormat(t *testing.T) {
+  sb := NewSourceFromBuffer(strings.Bytes("def One: 1 +\n  2\n\tx y\n"), "foo.dia");
+  diags := common.NewDiagnosticList();
+  sb.SetDiagnosticSink(diags);
+  skip(sb, 5);
+  mark := sb.NewMark();
+  skip(sb, 3);
+  sb.NewPiece(mark).Error("Word");
+  skip(sb, 4);
+  mark = sb.NewMark();
+  skip(sb, 5);
+  sb.NewPiece(mark).Error("Lines");
+  mark = sb.NewMark();
+  skip(sb, 1);
+  sb.NewPiece(mark).Error("Newline");
+  skip(sb, 3);
+  sb.Error("Tab");
+
+  expected := []string{
+    "foo.dia:1:5: error: Word\ndef One: 1 +\n    ^^^\n",
+    "foo.dia:1:12: error: Lines\ndef One: 1 +\n           ^\n  2\n^^^\n",
+    "foo.dia:2:4: error: Newline\n  2\n   ^\n",
+    "foo.dia:3:4: error: Tab\n\tx y\n\t  ^\n",
+  };
+  for i, diag := range diags.Diagnostics() {
+    if diag.String() != expected[i] {
+      t.Errorf("Expected diagnostic:\n%s\nbut got:\n%s", expected[i], diag);
+    }
+  }
+  if diags.Len() != len(expected) {
+    t.Errorf("Expected %d diagnostics, but got %d.", len(expected), diags.Len());
+  }
+  json := `"file": "foo.dia", "start": {"line": 1, "column": 12}, ` +
+          `"end": {"line": 2, "column": 4}`;
+  if strings.Index(diags.JSON(), json) < 0 {
+    t.Errorf("Expected JSON with `%s`, but got:\n%s", json, diags.JSON());
+  }
+}
+
+func TestFileSet(t *testing.T) {
+  fs := NewFileSet();
+  a := fs.AddBuffer(strings.Bytes("a"), "a.dia");
+  diags := common.NewDiagnosticList();
+  fs.SetDiagnosticSink(diags);
+  b := fs.AddBuffer(strings.Bytes("b"), "b.dia");
+  if a.ID() != 1 || b.ID() != 2 || fs.Len() != 2 || fs.Source(2) != b ||
+     fs.Source(3) != nil || NewSourceFromBuffer(nil, "c.dia").ID() != 0 {
+    t.Error("Sources got wrong IDs.");
+  }
+  a.Getch();
+  b.Getch();
+  a.Error("A");
+  b.Error("B");
+  diag := diags.Diagnostics();
+  if len(diag) != 2 || diag[0].Piece.FileID() != 1 ||
+     diag[1].Piece.FileID() != 2 || diag[1].Piece.FileName() != "b.dia" {
+    t.Errorf("Errors reported wrong:\n%s", diags);
+  }
+}
+
+// skip - read n characters; the current character is the last of them.
+func skip(sb *SrcBuffer, n int) {
+  for ; n > 0; n-- { sb.Getch(); }
+}
+
 func testSrcPiece(piece common.SrcPiece, line int, column int,
                   content string, wholeLine string, t *testing.T, num int) {
   failed := false;
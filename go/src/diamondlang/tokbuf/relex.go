@@ -0,0 +1,297 @@
+package tokbuf
+
+import (
+  "diamondlang/common";
+  "diamondlang/lexer";
+  "diamondlang/srcbuf";
+  "container/list";
+  "os";
+  "strings";
+  "utf8";
+)
+
+
+// --------------------------------------------------------------------------
+// Incremental lexing (e.g. for editors):
+// A token list holds all tokens of a text. After an edit of the text only
+// the changed lines are lexed again.
+// --------------------------------------------------------------------------
+
+// TextEdit - Replace the text between the start and the end position.
+// Lines and columns are counted from 0 and columns are counted in runes.
+type TextEdit struct {
+  StartLine, StartColumn int;
+  EndLine, EndColumn     int;
+  Text                   string;
+}
+
+// lineStart - A line where lexing can start again because no token and no
+// parentheses continue into it.
+type lineStart struct {
+  line        int;          // number of the line
+  token       int;          // index of the first token of the line
+  state       *lexer.State; // state of the lexer at the start of the line
+  indentLevel int;          // indentation level of the token buffer
+}
+
+type TokenList struct {
+  name   string;
+  lines  []string;        // the text line by line (with line endings)
+  tokens []common.Token;  // as delivered by a token buffer
+  starts []*lineStart;    // in the order of their lines
+  sink   common.DiagnosticSink;
+}
+
+func (tl *TokenList) Tokens() []common.Token { return tl.tokens; }
+func (tl *TokenList) Text() string { return strings.Join(tl.lines, ""); }
+
+// LexAll - Lex the whole text and return its tokens.
+// Errors are reported to the sink (or to STDERR if it is nil).
+func LexAll(name string, text string, sink common.DiagnosticSink) *TokenList {
+  tl := &TokenList{name, splitLines(text), nil, nil, sink};
+  r := tl.newRun(0, nil, 0);
+  r.lexUntil(nil);
+  tl.tokens, tl.starts = r.tokenSlice(), r.startSlice(0, 0);
+  return tl;
+}
+
+// Relex - Apply the edit to the text of the token list and return the new
+// tokens. Lexing starts again at the last line start in front of the edit
+// and stops at the first line start behind it where lexer and token buffer
+// are in the same state as before.
+// The tokens behind that line are reused (with new line numbers), so the
+// previous token list mustn't be used any more.
+// Only errors in the lexed lines are reported (again).
+func Relex(prev *TokenList, edit *TextEdit) (*TokenList, os.Error) {
+  lines, delta, err := applyEdit(prev.lines, edit);
+  if err != nil { return nil, err; }
+  tl := &TokenList{prev.name, lines, nil, nil, prev.sink};
+
+  first := 0;
+  for i, ls := range prev.starts {
+    if ls.line > edit.StartLine { break; }
+    first = i;
+  }
+  start := prev.starts[first];
+  behind := make(map[int]*lineStart);
+  for i := first; i < len(prev.starts); i++ {
+    ls := prev.starts[i];
+    if ls.line > edit.EndLine { behind[ls.line] = ls; }
+  }
+
+  sync := (*lineStart)(nil);
+  r := tl.newRun(start.line, start.state, start.indentLevel);
+  r.lexUntil(func(line int, st *lexer.State, indentLevel int) bool {
+    ls, ok := behind[line - delta];
+    if ok && ls.indentLevel == indentLevel && ls.state.Equals(st) {
+      sync = ls;
+    }
+    return sync != nil;
+  });
+
+  head, relexed := prev.tokens[0:start.token], r.tokenSlice();
+  tail := prev.tokens[len(prev.tokens):len(prev.tokens)];
+  tailStarts := prev.starts[len(prev.starts):len(prev.starts)];
+  if sync != nil {
+    tail = prev.tokens[sync.token:len(prev.tokens)];
+    for i := first; i < len(prev.starts); i++ {
+      if prev.starts[i] == sync { tailStarts = prev.starts[i:len(prev.starts)]; }
+    }
+    if delta != 0 { srcbuf.MoveLines(tokenPieces(tail), delta); }
+  }
+
+  tl.tokens = make([]common.Token, len(head) + len(relexed) + len(tail));
+  n := 0;
+  for _, tokens := range [][]common.Token{head, relexed, tail} {
+    for _, tok := range tokens {
+      tl.tokens[n] = tok;
+      n++;
+    }
+  }
+
+  runStarts := r.startSlice(len(head), 0);
+  tl.starts = make([]*lineStart, first + len(runStarts) + len(tailStarts));
+  n = 0;
+  for _, ls := range prev.starts[0:first] { tl.starts[n] = ls; n++; }
+  for _, ls := range runStarts { tl.starts[n] = ls; n++; }
+  moved := len(head) + len(relexed) - len(prev.tokens) + len(tail);
+  for _, ls := range tailStarts {
+    tl.starts[n] = &lineStart{ls.line + delta, ls.token + moved,
+                              ls.state, ls.indentLevel};
+    n++;
+  }
+  return tl, nil;
+}
+
+
+// --------------------------------------------------------------------------
+// A run lexes the lines of a token list from a line start on.
+// It is the lexer of its own token buffer, so it sees every line start.
+// --------------------------------------------------------------------------
+type run struct {
+  *lexer.Lexer;
+  tb      *tokBuf;
+  tokens  *list.List;
+  starts  *list.List;
+  stop    func(line int, st *lexer.State, indentLevel int) bool;
+  stopped bool;
+}
+
+func (tl *TokenList) newRun(line int, st *lexer.State, indentLevel int) *run {
+  sb := srcbuf.NewSourceFromReader(&linesReader{tl.lines, line, 0}, tl.name);
+  sb.SetFirstLine(line);
+  if tl.sink != nil { sb.SetDiagnosticSink(tl.sink); }
+  lx := lexer.NewLexer(sb).(*lexer.Lexer);
+  if st != nil { lx.SetState(st); }
+  r := &run{lx, nil, list.New(), list.New(), nil, false};
+  r.tb = &tokBuf{r, list.New(), nil, indentLevel};
+  return r;
+}
+
+// GetToken - Record the line starts while getting the tokens.
+// The token buffer has delivered all tokens of the previous lines when it
+// needs the first token of a line.
+func (r *run) GetToken() common.Token {
+  st := r.Lexer.LineStartState();
+  tok := r.Lexer.GetToken();
+  if st != nil && !r.stopped {
+    if r.stop != nil && r.stop(tok.StartLine(), st, r.tb.indentLevel) {
+      r.stopped = true;
+    } else {
+      r.starts.PushBack(&lineStart{tok.StartLine(), r.tokens.Len(), st,
+                                   r.tb.indentLevel});
+    }
+  }
+  return tok;
+}
+
+// lexUntil - Get the tokens up to EOF or up to the line start where stop
+// returns true.
+func (r *run) lexUntil(stop func(line int, st *lexer.State,
+                                 indentLevel int) bool) {
+  r.stop = stop;
+  for {
+    tok := r.tb.GetToken();
+    if r.stopped { break; }
+    r.tokens.PushBack(tok);
+    if tok.Type() == common.TOK_EOF { break; }
+  }
+}
+
+func (r *run) tokenSlice() []common.Token {
+  ret := make([]common.Token, r.tokens.Len());
+  i := 0;
+  for e := r.tokens.Front(); e != nil; e = e.Next() {
+    ret[i] = e.Value.(common.Token);
+    i++;
+  }
+  return ret;
+}
+
+// startSlice - Return the line starts with the token indices moved.
+func (r *run) startSlice(moveTokens int, moveLines int) []*lineStart {
+  ret := make([]*lineStart, r.starts.Len());
+  i := 0;
+  for e := r.starts.Front(); e != nil; e = e.Next() {
+    ls := e.Value.(*lineStart);
+    ret[i] = &lineStart{ls.line + moveLines, ls.token + moveTokens,
+                        ls.state, ls.indentLevel};
+    i++;
+  }
+  return ret;
+}
+
+
+// --------------------------------------------------------------------------
+// Helper functions for the text of a token list:
+// --------------------------------------------------------------------------
+
+// linesReader - Reads the text of the lines from a given line on.
+type linesReader struct {
+  lines []string;
+  line  int;
+  col   int;
+}
+
+func (lr *linesReader) ReadByte() (c byte, err os.Error) {
+  for lr.line < len(lr.lines) && lr.col >= len(lr.lines[lr.line]) {
+    lr.line++;
+    lr.col = 0;
+  }
+  if lr.line >= len(lr.lines) { return 0, os.EOF; }
+  c = lr.lines[lr.line][lr.col];
+  lr.col++;
+  return c, nil;
+}
+
+func (lr *linesReader) Read(p []byte) (n int, err os.Error) {
+  for ; n < len(p); n++ {
+    c, e := lr.ReadByte();
+    if e != nil {
+      if n == 0 { err = e; }
+      break;
+    }
+    p[n] = c;
+  }
+  return;
+}
+
+// splitLines - Split the text into lines that keep their line endings.
+// The last line is the one without line ending (it may be empty).
+func splitLines(text string) []string {
+  n := strings.Count(text, "\n") + 1;
+  ret := make([]string, n);
+  for i := 0; i < n-1; i++ {
+    j := strings.Index(text, "\n") + 1;
+    ret[i], text = text[0:j], text[j:len(text)];
+  }
+  ret[n-1] = text;
+  return ret;
+}
+
+// applyEdit - Return the lines after the edit and how many lines have been
+// added (or removed if negative).
+func applyEdit(lines []string, edit *TextEdit) ([]string, int, os.Error) {
+  if edit.StartLine < 0 || edit.EndLine >= len(lines) ||
+     edit.StartLine > edit.EndLine ||
+     (edit.StartLine == edit.EndLine && edit.StartColumn > edit.EndColumn) {
+    return nil, 0, os.NewError("Invalid range of the text edit");
+  }
+  first, last := lines[edit.StartLine], lines[edit.EndLine];
+  changed := splitLines(first[0:byteCol(first, edit.StartColumn)] + edit.Text +
+                        last[byteCol(last, edit.EndColumn):len(last)]);
+  if edit.EndLine < len(lines)-1 {
+    changed = changed[0:len(changed)-1];  // the line behind isn't changed
+  }
+
+  removed := edit.EndLine - edit.StartLine + 1;
+  ret := make([]string, len(lines) - removed + len(changed));
+  n := 0;
+  for _, part := range [][]string{lines[0:edit.StartLine], changed,
+                                  lines[edit.EndLine+1:len(lines)]} {
+    for _, l := range part {
+      ret[n] = l;
+      n++;
+    }
+  }
+  return ret, len(changed) - removed, nil;
+}
+
+// byteCol - Convert a column in runes into a byte position in the line.
+// Columns behind the end of the line stop in front of the line ending.
+func byteCol(line string, col int) int {
+  end := len(line);
+  for end > 0 && (line[end-1] == '\n' || line[end-1] == '\r') { end--; }
+  pos := 0;
+  for ; col > 0 && pos < end; col-- {
+    _, size := utf8.DecodeRuneInString(line[pos:end]);
+    pos += size;
+  }
+  return pos;
+}
+
+func tokenPieces(tokens []common.Token) []common.SrcPiece {
+  ret := make([]common.SrcPiece, len(tokens));
+  for i, tok := range tokens { ret[i] = tok.SourcePiece(); }
+  return ret;
+}
@@ -64,7 +64,7 @@ func (tb *tokBuf) getFilteredToken() common.Token {
 func (tb *tokBuf) ensureSize() {
   for tb.tokBuf.Len() > MAX_TOK {
     if tb.curTok == nil || tb.curTok.Prev() == nil {
-      tb.Error("Unable to remove current token from buffer");
+      panic("Unable to remove current token from buffer");
     }
     tb.tokBuf.Remove(tb.tokBuf.Front());
   }
@@ -130,14 +130,14 @@ func recordAnyIndent(spaces int, tok common.Token, tb *tokBuf) bool {
   if indent < 0 {
     recordDedent(-indent, tok, tb);
   } else if indent > 0 {
-    recordIndent(indent, tok, tb);
+    return recordIndent(indent, tok, tb);
   } else {
     return false;
   }
   return true;
 }
 
-func recordIndent(indent int, tok common.Token, tb *tokBuf) {
+func recordIndent(indent int, tok common.Token, tb *tokBuf) bool {
   // we can have half indentations (2 spaces) and
   //             full indentations (4 spaces)
   switch indent {
@@ -149,7 +149,9 @@ func recordIndent(indent int, tok common.Token, tb *tokBuf) {
     tb.curTok = tb.tokBuf.PushBack(tb.lx.NewCopyTok(common.TOK_INDENT, tok));
   default:
     tok.Error("Indentation error");
+    return false;  // ignore the indentation
   }
+  return true;
 }
 
 func recordDedent(dedent int, tok common.Token, tb *tokBuf) {
@@ -202,7 +204,7 @@ func handleDefault(tok common.Token, tb *tokBuf) bool {
 
 func (tb *tokBuf) any2token(val interface{}) common.Token {
   tok, ok := val.(common.Token);
-  if !ok { tb.Error("Not a token type"); }
+  if !ok { panic("Not a token type"); }
   return tok;
 }
 
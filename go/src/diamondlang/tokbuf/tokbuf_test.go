@@ -5,6 +5,7 @@ import (
   "diamondlang/common";
   "diamondlang/srcbuf";
   "diamondlang/lexer";
+  "fmt";
   "strings";
 )
 
@@ -152,7 +153,7 @@ func TestSemiNl(t *testing.T) {
 
 
 func testStringVsTokens(t *testing.T, str string, toks []*tstTok) {
-  tb := NewTokenBuffer(lexer.NewLexer(srcbuf.NewSourceFromBuffer(strings.Bytes(str))));
+  tb := NewTokenBuffer(lexer.NewLexer(srcbuf.NewSourceFromBuffer(strings.Bytes(str), "test")));
   var tok common.Token;
   var i   int;
   for tok, i = tb.GetToken(), 0; tok.Type() != common.TOK_EOF && i < len(toks);
@@ -162,7 +163,7 @@ func testStringVsTokens(t *testing.T, str string, toks []*tstTok) {
       if toks[i].typ != typ.Type() {
         t.Errorf("%d: Expected token type %v, but got: %v.\n", i, toks[i].typ, typ.Type());
       }
-      if toks[i].numVal != typ.Value() {
+      if toks[i].numVal != typ.Value().Int64() {
         t.Errorf("%d: Expected value %v, but got: %v.\n", i, toks[i].numVal, typ.Value());
       }
     case *lexer.CharTok:
@@ -205,3 +206,84 @@ func testStringVsTokens(t *testing.T, str string, toks []*tstTok) {
   }
 }
 
+
+
+var relexSources = []string{
+`If bla > 0:
+    mod.Func (mod.CONST +
+      2) Fn i
+  Elif bla < 0:   # blue
+    mod.FuncAli "bla"
+  Else:
+    bla.val  # should work!
+
+bla = 0
+   # geschafft!`,
+`# diamond: tabsize=2
+If a:
+	b
+c`,
+}
+
+var relexTexts = []string{"", "x", "\n", "  ", "    ", "(", ")", ":\n  y", "#",
+                          "\"", "\n\n", "# diamond: strict-indent\n"}
+
+func TestRelex(t *testing.T) {
+  for _, src := range relexSources {
+    lines := strings.Split(src, "\n", 0);
+    for l := 0; l < len(lines); l++ {
+      for _, col := range []int{0, 2, 100} {
+        for _, text := range relexTexts {
+          testRelex(t, src, &TextEdit{l, col, l, col, text});
+          if l+1 < len(lines) {
+            testRelex(t, src, &TextEdit{l, col, l+1, 1, text});
+          }
+        }
+      }
+    }
+  }
+}
+
+func TestRelexReusesTokens(t *testing.T) {
+  sink := common.NewDiagnosticList();
+  prev := LexAll("test", relexSources[0], sink);
+  last := prev.Tokens()[len(prev.Tokens())-2];
+  tl, err := Relex(prev, &TextEdit{0, 0, 0, 0, "x = 1\n\n"});
+  if err != nil { t.Fatal(err.String()); }
+  if tl.Tokens()[len(tl.Tokens())-2] != last {
+    t.Error("Tokens behind the edit are lexed again.");
+  }
+  if last.StartLine() != 11 {
+    t.Errorf("Expected moved token at line 11, but got: %d.", last.StartLine());
+  }
+  if _, err := Relex(tl, &TextEdit{3, 0, 20, 0, ""}); err == nil {
+    t.Error("Expected an error for an invalid edit.");
+  }
+}
+
+// testRelex - Compare the tokens of the relexed text with the ones of the
+// whole text lexed again.
+func testRelex(t *testing.T, src string, edit *TextEdit) {
+  sink := common.NewDiagnosticList();
+  tl, err := Relex(LexAll("test", src, sink), edit);
+  if err != nil { t.Fatal(err.String()); }
+  all := LexAll("test", tl.Text(), sink);
+  got, want := tl.Tokens(), all.Tokens();
+  for i := 0; i < len(got) && i < len(want); i++ {
+    if tokenDescription(got[i]) != tokenDescription(want[i]) {
+      t.Errorf("Edit %v of %q: %d: Expected token %s, but got: %s.", *edit,
+               src, i, tokenDescription(want[i]), tokenDescription(got[i]));
+      return;
+    }
+  }
+  if len(got) != len(want) {
+    t.Errorf("Edit %v of %q: Expected %d tokens, but got: %d.", *edit, src,
+             len(want), len(got));
+  }
+}
+
+func tokenDescription(tok common.Token) string {
+  p := tok.SourcePiece();
+  return fmt.Sprintf("%s (%d:%d-%d:%d)", tok.String(), p.StartLine(),
+                     p.StartColumn(), p.EndLine(), p.EndColumn());
+}
@@ -4,6 +4,8 @@ import (
   "diamondlang/common";
   "diamondlang/srcbuf";
   "diamondlang/lexer";
+  "diamondlang/interp";
+  "diamondlang/driver";
   "os";
   "flag";
   "fmt";
@@ -11,12 +13,33 @@ import (
 )
 
 var useCommandLine = flag.Bool("c", false, "use command line as source")
+var parseSource = flag.Bool("p", false, "parse the source and print its definitions with their types")
+var runSource = flag.Bool("r", false, "run the function Main of the source with the interpreter")
+var useColor = flag.Bool("color", false, "use ANSI colours in diagnostics")
+var diagFormat = flag.String("diagnostics-format", "text",
+                             "write diagnostics as text, json or sarif")
+var tabSize = flag.Int("tabsize", common.TABSIZE, "number of columns of a tab")
+var strictIndent = flag.Bool("strict-indent", false,
+                             "reject indentation with tabs and spaces mixed")
 
 
 func main() {
+  if len(os.Args) > 1 && os.Args[1] == "build" {
+    build(os.Args[2:len(os.Args)]);
+    return;
+  }
   flag.Parse(); // Scans the arg list and sets up flags
-  var sb common.SrcBuffer;
-  // fill the source buffer either from the command line or from a file:
+  if !common.IsDiagnosticFormat(*diagFormat) {
+    fmt.Fprintln(os.Stderr, "FATAL ERROR: Unknown diagnostics format:", *diagFormat);
+    os.Exit(1);
+  }
+  if *tabSize <= 0 {
+    fmt.Fprintln(os.Stderr, "FATAL ERROR: The tab size has to be positive!");
+    os.Exit(1);
+  }
+  common.TABSIZE, common.STRICT_INDENT = *tabSize, *strictIndent;
+  fs := srcbuf.NewFileSet();
+  // fill the file set either from the command line or from a file or directory:
   if *useCommandLine {
     if flag.NArg() <= 0 {
       fmt.Fprintln(os.Stderr, "FATAL ERROR: Need source line(s) as argument(s)!");
@@ -27,38 +50,78 @@ func main() {
     for i := 0; i < flag.NArg(); i++ {
       srcStr += flag.Arg(i) + "\n";
     }
-    sb = srcbuf.NewSourceFromBuffer(strings.Bytes(srcStr), "command line");
+    fs.AddBuffer(strings.Bytes(srcStr), "command line");
   } else {
     if flag.NArg() <= 0 {
-      fmt.Fprintln(os.Stderr, "FATAL ERROR: Need name of source file as argument!");
+      fmt.Fprintln(os.Stderr, "FATAL ERROR: Need name of source file or directory as argument!");
       os.Exit(1);
     }
 
-    // Initialize the source buffer:
+    // Initialize the source buffers:
     var err os.Error;
-    sb, err = srcbuf.NewSourceFromFile(flag.Arg(0));
+    fs, err = driver.OpenSources(flag.Arg(0));
     if err != nil {
-      fmt.Fprintf(os.Stderr, "FATAL ERROR: Unable to read source file '%s': %s\n",
+      fmt.Fprintf(os.Stderr, "FATAL ERROR: Unable to read source '%s': %s\n",
           flag.Arg(0), err);
       os.Exit(1);
     }
   }
 
+  diags := common.NewDiagnosticList();
+  if *diagFormat != "text" {
+    fs.SetDiagnosticSink(diags);  // written as a whole at the end
+  } else if *useColor {
+    printer := common.NewDiagnosticPrinter(os.Stderr);
+    printer.SetColor(true);
+    fs.SetDiagnosticSink(printer);
+  }
+
 //for ch := sb.Getch(); ch != common.EOF; ch = sb.Getch() {
 //  fmt.Println("Found char:", ch, string(ch));
 //}
 
-  // Initialize the lexer:
-  lx := lexer.NewLexer(sb);
+  if *parseSource || *runSource {
+    mod, err := driver.LoadSources(fs.Sources(), diags);
+    if err != nil { finish(diags, err); }
+    if *parseSource {
+      driver.PrintModule(os.Stdout, mod);
+      finish(diags, nil);
+      return;
+    }
+    _, err = interp.NewInterpreter(mod).Call("Main", make([]interface{}, 0));
+    finish(diags, err);
+    return;
+  }
 
   // Test output:
-  for tok := lx.GetToken(); tok.Type() != common.TOK_EOF; tok = lx.GetToken() {
-    switch t := tok.(type) {
-    case *lexer.IntTok:
-      fmt.Println("Got int:", t.Value(), t);
-    default:
-      fmt.Println("Got token:", t.Type(), t);
-    }
+  for _, sb := range fs.Sources() {
+    driver.PrintTokens(os.Stdout, lexer.NewLexer(sb));
   }
+  finish(diags, diags.Err());
+}
 
+func build(args []string) {
+  opts, err := driver.ParseBuildArgs(args);
+  if err != nil {
+    fmt.Fprintln(os.Stderr, "FATAL ERROR:", err);
+    fmt.Fprint(os.Stderr, driver.Usage);
+    os.Exit(1);
+  }
+  *useColor, *diagFormat = opts.Color, opts.DiagnosticsFormat;
+  diags := common.NewDiagnosticList();
+  finish(diags, driver.Build(opts, diags));
+}
+
+// finish - Write the collected diagnostics and exit if there is an error.
+// Machine readable formats are written even without any diagnostics.
+// Other errors than diagnostics are written as fatal errors.
+func finish(diags *common.DiagnosticList, err os.Error) {
+  if diags.Len() > 0 || *diagFormat != "text" {
+    fmt.Fprint(os.Stderr, diags.FormatAs(*diagFormat, *useColor));
+  }
+  if err == nil { return; }
+  if _, ok := err.(*common.DiagnosticList); !ok {
+    fmt.Fprintln(os.Stderr, "FATAL ERROR:", err);
+  }
+  os.Exit(1);
 }